@@ -5,10 +5,29 @@
 package encryption
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ethersphere/bee/pkg/swarm"
 	"golang.org/x/crypto/sha3"
 )
 
+// ErrReferenceSize is returned by SplitReference for a reference that is not
+// of the size of encrypted references.
+var ErrReferenceSize = errors.New("encryption: invalid reference size")
+
+// SplitReference returns the address of the stored encrypted root chunk and
+// the key decrypting it from an encrypted reference, which is ReferenceSize
+// bytes long: the swarm.HashSize bytes of the address followed by the
+// KeyLength bytes of the key.
+func SplitReference(ref swarm.Address) (swarm.Address, Key, error) {
+	b := ref.Bytes()
+	if len(b) != ReferenceSize {
+		return swarm.ZeroAddress, nil, ErrReferenceSize
+	}
+	return swarm.NewAddress(b[:swarm.HashSize]), Key(b[swarm.HashSize:]), nil
+}
+
 // ChunkEncrypter encrypts chunk data.
 type ChunkEncrypter interface {
 	EncryptChunk([]byte) (key Key, encryptedSpan, encryptedData []byte, err error)
@@ -39,3 +58,46 @@ func newSpanEncryption(key Key) Interface {
 func newDataEncryption(key Key) Interface {
 	return New(key, int(swarm.ChunkSize), 0, sha3.NewLegacyKeccak256)
 }
+
+type seededChunkEncrypter struct {
+	seed []byte
+}
+
+// NewSeededChunkEncrypter returns a ChunkEncrypter that derives the key and
+// the padding of each chunk from the seed and the chunk data instead of
+// generating them randomly. The same data encrypted with the same seed
+// always results in the same encrypted chunk, so that an interrupted upload
+// can be resumed to the same references. Chunks with the same data are not
+// distinguishable from each other within the content encrypted with a seed.
+func NewSeededChunkEncrypter(seed []byte) ChunkEncrypter {
+	return &seededChunkEncrypter{seed: seed}
+}
+
+func (c *seededChunkEncrypter) EncryptChunk(chunkData []byte) (Key, []byte, []byte, error) {
+	if len(chunkData)-8 > swarm.ChunkSize {
+		return nil, nil, nil, fmt.Errorf("data length longer than padding, data length %v padding %v", len(chunkData)-8, swarm.ChunkSize)
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	_, _ = h.Write(c.seed)
+	_, _ = h.Write(chunkData)
+	key := Key(h.Sum(nil))
+
+	encryptedSpan, err := newSpanEncryption(key).Encrypt(chunkData[:8])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryptedData, err := New(key, 0, 0, sha3.NewLegacyKeccak256).Encrypt(chunkData[8:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// pad the data with the key stream of a key derived from the chunk key
+	h.Reset()
+	_, _ = h.Write(key)
+	padding, err := New(h.Sum(nil), 0, 0, sha3.NewLegacyKeccak256).Encrypt(make([]byte, swarm.ChunkSize-len(encryptedData)))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key, encryptedSpan, append(encryptedData, padding...), nil
+}
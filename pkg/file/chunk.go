@@ -0,0 +1,79 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/ethersphere/bee/pkg/bmtpool"
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+var (
+	// ErrNoReferences is returned when an intermediate chunk is requested
+	// without any child references.
+	ErrNoReferences = errors.New("file: no references")
+	// ErrInconsistentReferences is returned when child references of an
+	// intermediate chunk are not of the same length.
+	ErrInconsistentReferences = errors.New("file: inconsistent reference lengths")
+	// ErrTooManyReferences is returned when child references do not fit
+	// into a single chunk.
+	ErrTooManyReferences = errors.New("file: too many references")
+)
+
+// ZeroChunkAddress is the address of the data chunk of swarm.ChunkSize zero
+// bytes. Joiners do not need to retrieve it to read its data.
+var ZeroChunkAddress = func() swarm.Address {
+	ch, err := cac.New(make([]byte, swarm.ChunkSize))
+	if err != nil {
+		panic(err)
+	}
+	return ch.Address()
+}()
+
+// MetadataWrapperPrefix starts the data of the wrappers referencing data and
+// the metadata attached to it, followed by the two references, so that a
+// wrapper is not of the length of an encrypted reference and taken for one.
+var MetadataWrapperPrefix = []byte("swarm-metadata")
+
+// IntermediateChunkAddress computes the address of the intermediate chunk
+// with the ordered child references refs, covering span bytes of data.
+// It returns the address together with the serialized chunk data, which is
+// the little-endian span followed by the concatenated references, in the
+// same form as intermediate chunks produced by the hashtrie.
+func IntermediateChunkAddress(span uint64, refs [][]byte) (swarm.Address, []byte, error) {
+	if len(refs) == 0 {
+		return swarm.ZeroAddress, nil, ErrNoReferences
+	}
+	refLen := len(refs[0])
+	if refLen == 0 {
+		return swarm.ZeroAddress, nil, ErrInconsistentReferences
+	}
+	if len(refs)*refLen > swarm.ChunkSize {
+		return swarm.ZeroAddress, nil, ErrTooManyReferences
+	}
+
+	data := make([]byte, swarm.SpanSize, swarm.SpanSize+len(refs)*refLen)
+	binary.LittleEndian.PutUint64(data, span)
+	for _, ref := range refs {
+		if len(ref) != refLen {
+			return swarm.ZeroAddress, nil, ErrInconsistentReferences
+		}
+		data = append(data, ref...)
+	}
+
+	hasher := bmtpool.Get()
+	defer bmtpool.Put(hasher)
+
+	if err := hasher.SetSpanBytes(data[:swarm.SpanSize]); err != nil {
+		return swarm.ZeroAddress, nil, err
+	}
+	if _, err := hasher.Write(data[swarm.SpanSize:]); err != nil {
+		return swarm.ZeroAddress, nil, err
+	}
+	return swarm.NewAddress(hasher.Sum(nil)), data, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/storage/mock"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// TestIntermediateChunkAddress verifies that the root chunk of a file
+// produced by the pipeline is reproduced from its child references.
+func TestIntermediateChunkAddress(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 3*swarm.ChunkSize + 100
+	data := make([]byte, size)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+
+	pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false)
+	root, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(data), int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootChunk, err := store.Get(ctx, storage.ModeGetRequest, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs [][]byte
+	payload := rootChunk.Data()[swarm.SpanSize:]
+	for i := 0; i < len(payload); i += swarm.HashSize {
+		refs = append(refs, payload[i:i+swarm.HashSize])
+	}
+
+	addr, chunkData, err := file.IntermediateChunkAddress(uint64(size), refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.Equal(root) {
+		t.Fatalf("got address %s, want %s", addr, root)
+	}
+	if !bytes.Equal(chunkData, rootChunk.Data()) {
+		t.Fatal("chunk data mismatch")
+	}
+
+	_, _, err = file.IntermediateChunkAddress(uint64(size), nil)
+	if !errors.Is(err, file.ErrNoReferences) {
+		t.Fatalf("got error %v, want %v", err, file.ErrNoReferences)
+	}
+	_, _, err = file.IntermediateChunkAddress(uint64(size), [][]byte{refs[0], refs[1][:10]})
+	if !errors.Is(err, file.ErrInconsistentReferences) {
+		t.Fatalf("got error %v, want %v", err, file.ErrInconsistentReferences)
+	}
+}
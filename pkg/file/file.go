@@ -20,7 +20,11 @@ type Reader interface {
 // Joiner provides the inverse functionality of the Splitter.
 type Joiner interface {
 	Reader
+	// Close releases the resources held by the joiner, such as chunk
+	// retrievals that are still in progress.
+	io.Closer
 	// IterateChunkAddresses is used to iterate over chunks addresses of some root hash.
+	// For encrypted content, the addresses are the ones of the stored encrypted chunks.
 	IterateChunkAddresses(swarm.AddressIterFunc) error
 	// Size returns the span of the hash trie represented by the joiner's root hash.
 	Size() int64
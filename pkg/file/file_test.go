@@ -7,6 +7,7 @@ package file_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strconv"
 	"strings"
@@ -14,8 +15,10 @@ import (
 
 	"github.com/ethersphere/bee/pkg/file"
 	"github.com/ethersphere/bee/pkg/file/joiner"
+	"github.com/ethersphere/bee/pkg/file/loadsave"
 	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
 	test "github.com/ethersphere/bee/pkg/file/testing"
+	"github.com/ethersphere/bee/pkg/manifest"
 	"github.com/ethersphere/bee/pkg/storage"
 	"github.com/ethersphere/bee/pkg/storage/mock"
 	"github.com/ethersphere/bee/pkg/swarm"
@@ -85,3 +88,63 @@ func testSplitThenJoin(t *testing.T) {
 		t.Fatalf("data mismatch %d", len(data))
 	}
 }
+
+// TestMergeManifests merges two files into a manifest and resolves each of
+// them back through the manifest.
+func TestMergeManifests(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	files := map[string][]byte{
+		"index.html":   []byte("<html></html>"),
+		"img/logo.png": bytes.Repeat([]byte{1, 2, 3}, swarm.ChunkSize),
+	}
+	roots := make(map[string]swarm.Address)
+	for path, data := range files {
+		p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false)
+		addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots[path] = addr
+	}
+
+	ls := loadsave.New(store, storage.ModePutUpload, false)
+	addr, err := file.MergeManifests(ctx, ls, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := manifest.NewMantarayManifestReference(addr, ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range files {
+		e, err := m.Lookup(ctx, path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if !e.Reference().Equal(roots[path]) {
+			t.Fatalf("%s: got reference %s, want %s", path, e.Reference(), roots[path])
+		}
+
+		j, _, err := joiner.New(ctx, store, e.Reference())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if _, err := file.JoinReadAll(ctx, j, &b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), data) {
+			t.Fatalf("%s: data mismatch", path)
+		}
+	}
+
+	if _, err := m.Lookup(ctx, "img"); !errors.Is(err, manifest.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, manifest.ErrNotFound)
+	}
+	if _, err := file.MergeManifests(ctx, ls, map[string]swarm.Address{"": roots["index.html"]}); !errors.Is(err, file.ErrEmptyPath) {
+		t.Fatalf("got error %v, want %v", err, file.ErrEmptyPath)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.18
+
+package file_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file/joiner"
+	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
+	test "github.com/ethersphere/bee/pkg/file/testing"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/storage/mock"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// maxFuzzSize is the maximum length of the data of FuzzPipelineJoiner,
+// spanning three levels of intermediate chunks.
+const maxFuzzSize = swarm.ChunkSize * 128 * 4
+
+// FuzzPipelineJoiner writes random data of random lengths with the pipeline
+// and reads it back with the joiner, checking that the data and its length
+// are the same. The data is generated from the seed, deterministically.
+func FuzzPipelineJoiner(f *testing.F) {
+	for i := 0; i < test.GetVectorCount(); i++ {
+		if l := test.GetVectorLength(i); l <= maxFuzzSize {
+			f.Add(uint32(l), int64(i), false)
+			f.Add(uint32(l), int64(i), true)
+		}
+	}
+	f.Add(uint32(0), int64(0), false)
+	f.Add(uint32(maxFuzzSize), int64(0), false)
+
+	f.Fuzz(func(t *testing.T, size uint32, seed int64, encrypt bool) {
+		ctx := context.Background()
+		store := mock.NewStorer()
+
+		data := make([]byte, size%(maxFuzzSize+1))
+		_, _ = mrand.New(mrand.NewSource(seed)).Read(data)
+		encryptionSeed := make([]byte, 8)
+		binary.BigEndian.PutUint64(encryptionSeed, uint64(seed))
+
+		p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, encrypt, builder.WithEncryptionSeed(encryptionSeed))
+		addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		j, span, err := joiner.New(ctx, store, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if span != int64(len(data)) {
+			t.Fatalf("got span %d, want %d", span, len(data))
+		}
+		b, err := ioutil.ReadAll(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("data mismatch for length %d", len(data))
+		}
+	})
+}
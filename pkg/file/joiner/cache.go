@@ -0,0 +1,250 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// Cache shares the intermediate chunks of a hash trie between all the
+// joiners of the same root obtained from it, so that concurrent downloads
+// of the same file resolve the trie only once. The data chunks they fetch,
+// eagerly or ahead of the reads included, are shared as well, up to
+// cacheDataLimit chunks of each root.
+type Cache struct {
+	getter storage.Getter
+	mu     sync.Mutex
+	roots  map[cacheKey]*cacheEntry
+}
+
+// cacheDataLimit is the number of data chunks of a root kept by a Cache.
+const cacheDataLimit = eagerPrefetchWindow
+
+// cacheKey identifies the joiners of a Cache that interpret the root the
+// same, as the options that change how the trie is read are part of it.
+type cacheKey struct {
+	root          string
+	chunkSize     int64
+	spanCodec     string
+	decryptionKey string
+	indirection   int
+}
+
+type cacheEntry struct {
+	refs   int
+	chunks *chunkCache
+	data   *chunkCache
+}
+
+// NewCache creates a new Cache of joiners reading from the getter.
+func NewCache(getter storage.Getter) *Cache {
+	return &Cache{
+		getter: getter,
+		roots:  make(map[cacheKey]*cacheEntry),
+	}
+}
+
+// Join returns a Joiner of the address, like New, which shares chunks with all
+// the other joiners of the same address attached to the cache with the same
+// chunk size, span codec, decryption key and indirection options. The returned
+// release function detaches the joiner from the cache and must be called once
+// the joiner is no longer used. Chunks of a root are evicted when its last
+// joiner is released.
+func (c *Cache) Join(ctx context.Context, address swarm.Address, opts ...Option) (j file.Joiner, span int64, release func(), err error) {
+	o := newOptions(opts)
+	key := cacheKey{
+		root:          address.ByteString(),
+		chunkSize:     o.chunkSize,
+		spanCodec:     fmt.Sprintf("%T%v", o.spanCodec, o.spanCodec),
+		decryptionKey: string(o.decryptionKey),
+		indirection:   o.indirection,
+	}
+
+	c.mu.Lock()
+	e, ok := c.roots[key]
+	if !ok {
+		e = &cacheEntry{chunks: newChunkCache(), data: newChunkCache()}
+		e.data.limit = cacheDataLimit
+		c.roots[key] = e
+	}
+	e.refs++
+	c.mu.Unlock()
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			e.refs--
+			if e.refs == 0 && c.roots[key] == e {
+				delete(c.roots, key)
+			}
+		})
+	}
+
+	j, span, err = New(ctx, c.getter, address, append(opts, withChunkCache(e.chunks, e.data))...)
+	if err != nil {
+		release()
+		return nil, 0, nil, err
+	}
+	return j, span, release, nil
+}
+
+func (c *Cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.roots)
+}
+
+// chunkCache keeps retrieved chunks in memory and deduplicates concurrent
+// retrievals of the same chunk. A retrieval is not bound to the context of the
+// caller that started it, but cancelled once all the callers waiting for it
+// are done, so that a cancelled caller does not fail the others.
+type chunkCache struct {
+	mu      sync.Mutex
+	chunks  map[string]swarm.Chunk
+	fetches map[string]*chunkFetch
+	limit   int // maximum number of chunks kept, unlimited if zero
+}
+
+// chunkFetch is a retrieval of a chunk in progress.
+type chunkFetch struct {
+	done    chan struct{} // closed when the retrieval terminates
+	ch      swarm.Chunk
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newChunkCache() *chunkCache {
+	return &chunkCache{
+		chunks:  make(map[string]swarm.Chunk),
+		fetches: make(map[string]*chunkFetch),
+	}
+}
+
+func (c *chunkCache) get(ctx context.Context, getter storage.Getter, addr swarm.Address) (swarm.Chunk, error) {
+	return c.fetch(ctx, getter, addr, true)
+}
+
+// fetch returns the cached chunk, removing it unless keep is true, or waits
+// for the retrieval of the chunk in progress, or starts one, caching the chunk
+// if keep is true.
+func (c *chunkCache) fetch(ctx context.Context, getter storage.Getter, addr swarm.Address, keep bool) (swarm.Chunk, error) {
+	key := addr.ByteString()
+
+	c.mu.Lock()
+	if ch, ok := c.chunks[key]; ok {
+		if !keep {
+			delete(c.chunks, key)
+		}
+		c.mu.Unlock()
+		return ch, nil
+	}
+	f, ok := c.fetches[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		f = &chunkFetch{done: make(chan struct{}), cancel: cancel}
+		c.fetches[key] = f
+		go func() {
+			ch, err := getter.Get(fctx, storage.ModeGetRequest, addr)
+			cancel()
+
+			c.mu.Lock()
+			if c.fetches[key] == f {
+				delete(c.fetches, key)
+				if err == nil && keep {
+					c.add(key, ch)
+				}
+			}
+			c.mu.Unlock()
+
+			f.ch, f.err = ch, err
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.ch, f.err
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	f.waiters--
+	last := f.waiters == 0
+	if last && c.fetches[key] == f {
+		// the next callers start over
+		delete(c.fetches, key)
+	}
+	c.mu.Unlock()
+	if last {
+		f.cancel()
+		<-f.done
+	}
+	return nil, ctx.Err()
+}
+
+// add keeps the chunk, evicting any other one if the cache is full. It must be
+// called with the lock held.
+func (c *chunkCache) add(key string, ch swarm.Chunk) {
+	if c.limit > 0 && len(c.chunks) >= c.limit {
+		// evict any chunk to make room
+		for k := range c.chunks {
+			delete(c.chunks, k)
+			break
+		}
+	}
+	c.chunks[key] = ch
+}
+
+func (c *chunkCache) remove(addr swarm.Address) {
+	c.mu.Lock()
+	delete(c.chunks, addr.ByteString())
+	c.mu.Unlock()
+}
+
+// take returns the chunk, removing it from the cache. If the chunk is not
+// cached, it waits for a retrieval of it in progress, or retrieves it without
+// caching it.
+func (c *chunkCache) take(ctx context.Context, getter storage.Getter, addr swarm.Address) (swarm.Chunk, error) {
+	ch, err := c.fetch(ctx, getter, addr, false)
+	if err != nil {
+		return nil, err
+	}
+	c.remove(addr)
+	return ch, nil
+}
+
+// cachedGetter retrieves the chunks through a chunk cache.
+type cachedGetter struct {
+	chunks *chunkCache
+	getter storage.Getter
+}
+
+func (g *cachedGetter) Get(ctx context.Context, _ storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	return g.chunks.get(ctx, g.getter, addr)
+}
+
+// detachedContext carries the values of a context, without its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
@@ -0,0 +1,43 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import "hash"
+
+// Digester is implemented by the joiners returned by New.
+type Digester interface {
+	// Digest returns the digest of the data computed by the hash of
+	// WithDigest, once the data was read to the end with Read. It returns
+	// nil before, if the data was not consecutively read from its start, or
+	// if the joiner was not created WithDigest.
+	Digest() []byte
+}
+
+// digest hashes the data as it is read consecutively from its start.
+type digest struct {
+	h      hash.Hash
+	off    int64 // offset of the data hashed so far
+	broken bool  // whether the data was not read consecutively
+}
+
+// add hashes the data b read at the offset off.
+func (d *digest) add(b []byte, off int64) {
+	if d.broken || len(b) == 0 {
+		return
+	}
+	if off != d.off {
+		d.broken = true
+		return
+	}
+	_, _ = d.h.Write(b)
+	d.off += int64(len(b))
+}
+
+func (j *joiner) Digest() []byte {
+	if j.digest == nil || j.digest.broken || j.digest.off != j.span {
+		return nil
+	}
+	return j.digest.h.Sum(nil)
+}
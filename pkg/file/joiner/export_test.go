@@ -0,0 +1,9 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+func (c *Cache) Len() int { return c.len() }
+
+const EagerPrefetchWindow = eagerPrefetchWindow
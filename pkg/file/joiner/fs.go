@@ -0,0 +1,258 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.16
+
+package joiner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+	"github.com/ethersphere/manifest/mantaray"
+)
+
+// errIsDir is returned by Read on a directory of the file system.
+var errIsDir = errors.New("is a directory")
+
+// FS returns a read-only file system of the entries of the mantaray manifest
+// of the address. The files are joiners, created with the options, of the
+// references of the entries, and the directories are the prefixes of the
+// entry paths up to a path separator. The manifest is retrieved as it is
+// accessed, lazily.
+func FS(ctx context.Context, getter storage.Getter, address swarm.Address, opts ...Option) fs.FS {
+	return &manifestFS{
+		ctx:    ctx,
+		getter: getter,
+		opts:   opts,
+		root:   mantaray.NewNodeRef(address.Bytes()),
+	}
+}
+
+type manifestFS struct {
+	ctx    context.Context
+	getter storage.Getter
+	opts   []Option
+
+	mu   sync.Mutex // the nodes of the manifest are loaded in place
+	root *mantaray.Node
+}
+
+// Load implements mantaray.Loader.
+func (f *manifestFS) Load(ctx context.Context, ref []byte) ([]byte, error) {
+	return readAll(ctx, f.getter, swarm.NewAddress(ref), -1)
+}
+
+func (f *manifestFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		entry, err := f.lookup(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if entry != nil {
+			j, span, err := New(f.ctx, f.getter, swarm.NewAddress(entry), f.opts...)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			return &fsFile{Joiner: j, info: fileInfo{name: path.Base(name), size: span}}, nil
+		}
+	}
+
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &fsDir{info: fileInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// lookup returns the reference of the entry of the path, or nil if there is
+// no entry.
+func (f *manifestFS) lookup(name string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.root.LookupNode(f.ctx, []byte(name), f)
+	if err != nil {
+		if errors.Is(err, mantaray.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !n.IsValueType() || isZero(n.Entry()) {
+		return nil, nil
+	}
+	return n.Entry(), nil
+}
+
+// readDir returns the sorted entries of the directory, which are empty if the
+// directory does not exist.
+func (f *manifestFS) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	var (
+		files = make(map[string]swarm.Address)
+		dirs  = make(map[string]struct{})
+	)
+	f.mu.Lock()
+	err := f.root.WalkNode(f.ctx, nil, f, func(p []byte, n *mantaray.Node, err error) error {
+		if err != nil {
+			return err
+		}
+		if !n.IsValueType() || isZero(n.Entry()) || !strings.HasPrefix(string(p), prefix) {
+			return nil
+		}
+		rel := string(p[len(prefix):])
+		if i := strings.IndexByte(rel, '/'); i >= 0 {
+			if i > 0 {
+				dirs[rel[:i]] = struct{}{}
+			}
+			return nil
+		}
+		if rel != "" {
+			files[rel] = swarm.NewAddress(n.Entry())
+		}
+		return nil
+	})
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(files)+len(dirs))
+	for d := range dirs {
+		entries = append(entries, &dirEntry{info: fileInfo{name: d, dir: true}})
+	}
+	for name, addr := range files {
+		if _, ok := dirs[name]; ok {
+			continue
+		}
+		entries = append(entries, &dirEntry{fs: f, addr: addr, info: fileInfo{name: name}})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// fsFile is a file of the manifest file system.
+type fsFile struct {
+	file.Joiner
+	info fileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDir is a directory of the manifest file system.
+type fsDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if count <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.off += count
+	return rest[:count], nil
+}
+
+// dirEntry is an entry of a directory of the manifest file system. The sizes
+// of the files are known once their root chunks are retrieved by Info.
+type dirEntry struct {
+	fs   *manifestFS
+	addr swarm.Address
+	info fileInfo
+}
+
+func (e *dirEntry) Name() string      { return e.info.name }
+func (e *dirEntry) IsDir() bool       { return e.info.dir }
+func (e *dirEntry) Type() fs.FileMode { return e.info.Mode().Type() }
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.info.dir {
+		return e.info, nil
+	}
+	j, span, err := New(e.fs.ctx, e.fs.getter, e.addr, e.fs.opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Close()
+
+	info := e.info
+	info.size = span
+	return info, nil
+}
+
+// fileInfo describes the files and directories of the manifest file system.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
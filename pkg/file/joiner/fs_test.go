@@ -0,0 +1,94 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.16
+
+package joiner_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file/joiner"
+	"github.com/ethersphere/bee/pkg/file/loadsave"
+	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
+	"github.com/ethersphere/bee/pkg/manifest"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/storage/mock"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	files := map[string][]byte{
+		"a.txt":         []byte("a"),
+		"dir/b.txt":     []byte("bb"),
+		"dir/sub/c.txt": bytes.Repeat([]byte("c"), 10000),
+	}
+
+	m, err := manifest.NewMantarayManifest(loadsave.New(store, storage.ModePutUpload, false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, data := range files {
+		pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false)
+		addr, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Add(ctx, p, manifest.NewEntry(addr, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addr, err := m.Store(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := joiner.FS(ctx, store, addr)
+
+	var paths []string
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, files[p]) {
+			t.Errorf("file %s: data mismatch", p)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() != int64(len(files[p])) {
+			t.Errorf("file %s: got size %d, want %d", p, info.Size(), len(files[p]))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got paths %v, want %v", paths, want)
+	}
+
+	if _, err := fs.Stat(fsys, "dir/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/content"
+	"github.com/ethersphere/bee/pkg/encryption/store"
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// CorruptChunkError is returned for a chunk whose content does not hash
+// to its address.
+type CorruptChunkError struct {
+	Address swarm.Address
+}
+
+func (e *CorruptChunkError) Error() string {
+	return fmt.Sprintf("joiner: corrupt chunk %s", e.Address)
+}
+
+// FsckReport is the result of checking the chunks of a file with Fsck.
+type FsckReport struct {
+	// Checked is the number of chunks that were checked.
+	Checked int
+	// Missing holds the addresses of the chunks not found in the store.
+	Missing []swarm.Address
+	// Corrupt holds the addresses of the chunks whose content does not
+	// hash to their address.
+	Corrupt []swarm.Address
+}
+
+// Intact returns true if no missing or corrupt chunks were found.
+func (r FsckReport) Intact() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0
+}
+
+// Fsck walks the whole hash trie of the address and checks that every chunk
+// is present in the store and that its content hashes to its address.
+// Missing and corrupt chunks are reported, and their subtries are skipped.
+// For encrypted content, reported addresses are the ones of the stored
+// encrypted chunks.
+func Fsck(ctx context.Context, getter storage.Getter, address swarm.Address) (FsckReport, error) {
+	var report FsckReport
+	g := store.New(&fsckGetter{Getter: getter, report: &report})
+	skip := func(err error) bool {
+		var corrupt *CorruptChunkError
+		return errors.Is(err, storage.ErrNotFound) || errors.As(err, &corrupt)
+	}
+	if err := walkTrie(ctx, g, address, skip); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// Verify walks the whole hash trie of the address and checks that the
+// content of every chunk hashes to its address, discarding the data as soon
+// as it is checked. It returns a *CorruptChunkError for the first corrupt
+// chunk found, or the error of the getter for a chunk that cannot be
+// retrieved. For encrypted content, the address of the error is the one of
+// the stored encrypted chunk.
+func Verify(ctx context.Context, getter storage.Getter, address swarm.Address) error {
+	return walkTrie(ctx, store.New(&verifyGetter{Getter: getter}), address, nil)
+}
+
+// NewWithValidation creates a Joiner like New, which checks that the content
+// of every chunk it retrieves hashes to the address it is retrieved by. The
+// reads return a *CorruptChunkError for the first corrupt chunk found, as New
+// does for a corrupt root chunk. For encrypted content, the address of the
+// error is the one of the stored encrypted chunk.
+func NewWithValidation(ctx context.Context, getter storage.Getter, address swarm.Address, opts ...Option) (file.Joiner, int64, error) {
+	return New(ctx, &verifyGetter{Getter: getter}, address, opts...)
+}
+
+// walkTrie retrieves all the chunks of the trie of the address. The subtries
+// of the chunks whose retrieval fails with an error reported by skip are
+// skipped, while any other error stops the walk.
+func walkTrie(ctx context.Context, getter storage.Getter, address swarm.Address, skip func(error) bool) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	ch, err := getter.Get(ctx, storage.ModeGetRequest, address)
+	if err != nil {
+		if skip != nil && skip(err) {
+			return nil
+		}
+		return err
+	}
+
+	data := ch.Data()[swarm.SpanSize:]
+	refLength := len(address.Bytes())
+	span := int64(file.LittleEndianSpan.DecodeSpan(ch.Data()[:swarm.SpanSize]))
+	parities := 0
+	if p := redundancy.Parities(ch.Data()[:swarm.SpanSize]); p > 0 && p <= redundancy.MaxParities && refLength == swarm.HashSize {
+		span = redundancy.DecodeSpan(ch.Data()[:swarm.SpanSize])
+		parities = p
+	}
+	// we are at a leaf data chunk
+	if uint64(span) <= uint64(len(data)) {
+		return nil
+	}
+
+	refs := len(data) - parities*refLength
+	for cursor := 0; cursor+refLength <= len(data); cursor += refLength {
+		addr := swarm.NewAddress(data[cursor : cursor+refLength])
+		if cursor < refs {
+			if err := walkTrie(ctx, getter, addr, skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the parity chunks do not reference other chunks
+		if _, err := getter.Get(ctx, storage.ModeGetRequest, addr); err != nil && (skip == nil || !skip(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsckGetter records the chunks retrieved by Fsck in the report, returning an
+// error for the missing and corrupt ones.
+type fsckGetter struct {
+	storage.Getter
+	report *FsckReport
+}
+
+func (g *fsckGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	ch, err := g.Getter.Get(ctx, mode, addr)
+	if errors.Is(err, storage.ErrNotFound) {
+		g.report.Checked++
+		g.report.Missing = append(g.report.Missing, addr)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g.report.Checked++
+	if !content.Valid(ch) {
+		g.report.Corrupt = append(g.report.Corrupt, addr)
+		return nil, &CorruptChunkError{Address: addr}
+	}
+	return ch, nil
+}
+
+// verifyGetter returns an error for the corrupt chunks retrieved by Verify
+// and the joiners created by NewWithValidation.
+type verifyGetter struct {
+	storage.Getter
+}
+
+func (g *verifyGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	ch, err := g.Getter.Get(ctx, mode, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !content.Valid(ch) {
+		return nil, &CorruptChunkError{Address: addr}
+	}
+	return ch, nil
+}
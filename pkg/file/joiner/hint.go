@@ -0,0 +1,148 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// Hinter is implemented by the joiners returned by New.
+type Hinter interface {
+	// Hint makes the joiner fetch the data chunks with the indices in the
+	// background, ahead of the reads that are expected to need them. Hints
+	// are advisory: indices out of range are ignored, the fetches are
+	// limited to a few at a time, as well as by the budget set with
+	// WithFetchBudget, and at most hintLimit chunks are kept until they are
+	// read. The chunks of joiners WithEagerPrefetch or WithReadAhead are
+	// kept with the ones they fetch, within their limits, so that they are
+	// fetched once. Fetches still in progress are cancelled by Close.
+	Hint(indices []int)
+}
+
+// hintLimit is the number of chunks fetched for hints kept until they are
+// read, beyond which chunks are evicted to make room for the next ones.
+const hintLimit = 256
+
+// hints keeps the data chunks fetched for hints until they are read.
+type hints struct {
+	chunks *chunkCache
+	ctx    context.Context // cancelled by Close
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (j *joiner) Hint(indices []int) {
+	j.hintsMu.Lock()
+	if j.hints == nil {
+		j.hints = newHints(j.ctx, eagerPrefetchWorkers, hintLimit)
+		// the chunks are fetched where the reads look for them first
+		switch {
+		case j.prefetched != nil:
+			j.hints.chunks = j.prefetched
+		case j.ahead != nil:
+			j.hints.chunks = j.ahead.chunks
+		}
+	}
+	h := j.hints
+	j.hintsMu.Unlock()
+
+	for _, i := range indices {
+		j.fetchLeaf(h, i)
+	}
+}
+
+// newHints returns hints fetching at most workers chunks at a time, and
+// keeping at most limit of them, or any number if limit is zero.
+func newHints(ctx context.Context, workers, limit int) *hints {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &hints{
+		chunks: newChunkCache(),
+		ctx:    ctx,
+		cancel: cancel,
+		sem:    make(chan struct{}, workers),
+	}
+	h.chunks.limit = limit
+	return h
+}
+
+// fetchLeaf fetches the data chunk with the index into the hints in the
+// background, unless the index is out of range.
+func (j *joiner) fetchLeaf(h *hints, i int) {
+	off := int64(i) * j.opts.chunkSize
+	if i < 0 || off >= j.span || j.span <= int64(len(j.rootData)) {
+		return
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		select {
+		case h.sem <- struct{}{}:
+		case <-h.ctx.Done():
+			return
+		}
+		defer func() { <-h.sem }()
+
+		addr, err := j.leafAddress(h.ctx, off)
+		if err != nil || addr.Equal(file.ZeroChunkAddress) {
+			return
+		}
+		_, _ = h.chunks.get(h.ctx, j.dataGetter, addr)
+	}()
+}
+
+// hinted returns the chunks fetched for hints, if any.
+func (j *joiner) hinted() *hints {
+	j.hintsMu.Lock()
+	defer j.hintsMu.Unlock()
+	return j.hints
+}
+
+// leafAddress returns the address of the data chunk with the data at the
+// offset, retrieving the intermediate chunks on the path to it. It returns
+// ErrInvalidSpan if an intermediate chunk on the path does not cover the
+// offset, as implied by the span of its parent.
+func (j *joiner) leafAddress(ctx context.Context, off int64) (swarm.Address, error) {
+	var (
+		data        = j.dataRefs(j.rootData)
+		subTrieSize = j.span
+		cur         int64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return swarm.ZeroAddress, err
+		}
+		found := false
+		for cursor := 0; cursor < len(data); cursor += j.refLength {
+			sec := j.section(data, cursor, subTrieSize)
+			if cur+sec <= off {
+				cur += sec
+				continue
+			}
+
+			address := swarm.NewAddress(data[cursor : cursor+j.refLength])
+			if sec <= j.opts.chunkSize {
+				return address, nil
+			}
+			ch, err := j.getChunk(ctx, address, sec)
+			if err != nil {
+				return swarm.ZeroAddress, err
+			}
+			data = j.dataRefs(ch.Data()[swarm.SpanSize:])
+			subTrieSize = j.decodeSpan(ch.Data()[:swarm.SpanSize])
+			found = true
+			break
+		}
+		if !found {
+			return swarm.ZeroAddress, ErrInvalidSpan
+		}
+	}
+}
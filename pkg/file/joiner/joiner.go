@@ -7,17 +7,22 @@ package joiner
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/encryption"
 	"github.com/ethersphere/bee/pkg/encryption/store"
 	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
 	"github.com/ethersphere/bee/pkg/storage"
 	"github.com/ethersphere/bee/pkg/swarm"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 type joiner struct {
@@ -25,72 +30,324 @@ type joiner struct {
 	rootData  []byte
 	span      int64
 	off       int64
+	goodOff   int64 // highest offset read successfully, accessed atomically
 	refLength int
+	parities  int // number of parity references of the intermediate chunks
 
-	ctx    context.Context
-	getter storage.Getter
+	ctx        context.Context
+	getter     storage.Getter
+	dataGetter storage.Getter // retrieves the data chunks
+	opts       *options
+
+	intermediates  *chunkCache        // intermediate chunks reused between reads
+	prefetched     *chunkCache        // chunks fetched ahead of reads
+	window         *prefetchWindow    // data chunks prefetched ahead of reads
+	prefetchCancel context.CancelFunc // cancels the eager prefetch
+	prefetchDone   chan struct{}      // closed when the eager prefetch terminates
+
+	hintsMu sync.Mutex
+	hints   *hints // data chunks fetched for hints
+
+	ahead     *hints // data chunks fetched ahead of Read, if enabled
+	aheadNext int    // index of the next data chunk to fetch ahead
+
+	sniffer *sniffer // detects the content type, if enabled
+	digest  *digest  // hashes the data read, if enabled
 }
 
+// intermediateCacheSize is the number of intermediate chunks a joiner keeps
+// to be reused between reads, unless it shares them through a Cache.
+const intermediateCacheSize = 64
+
+// emptyAddress is the address of the root chunk of a zero-length file.
+var emptyAddress = func() swarm.Address {
+	ch, err := cac.New(nil)
+	if err != nil {
+		panic(err)
+	}
+	return ch.Address()
+}()
+
 // New creates a new Joiner. A Joiner provides Read, Seek and Size functionalities.
-func New(ctx context.Context, getter storage.Getter, address swarm.Address) (file.Joiner, int64, error) {
-	getter = store.New(getter)
-	// retrieve the root chunk to read the total data length the be retrieved
-	rootChunk, err := getter.Get(ctx, storage.ModeGetRequest, address)
+//
+// The address of a zero-length file always results in a valid empty Joiner,
+// even if its root chunk is not stored. Any other root chunk that cannot be
+// retrieved results in the error returned by the getter, storage.ErrNotFound
+// in the case of a missing chunk.
+func New(ctx context.Context, getter storage.Getter, address swarm.Address, opts ...Option) (file.Joiner, int64, error) {
+	o := newOptions(opts)
+	if !o.validChunkSize(len(address.Bytes()) != swarm.HashSize || o.decryptionKey != nil) {
+		return nil, 0, ErrChunkSize
+	}
+	if o.decryptionKey != nil {
+		if len(o.decryptionKey) != encryption.KeyLength {
+			return nil, 0, ErrDecryptionKeyLength
+		}
+		if len(address.Bytes()) < swarm.HashSize {
+			return nil, 0, storage.ErrReferenceLength
+		}
+		ref := make([]byte, 0, encryption.ReferenceSize)
+		ref = append(append(ref, address.Bytes()[:swarm.HashSize]...), o.decryptionKey...)
+		address = swarm.NewAddress(ref)
+	}
+	if o.fallback != nil {
+		getter = &fallbackGetter{Getter: getter, fallback: o.fallback, timeout: o.primaryTimeout}
+	}
+	if o.budget != nil {
+		getter = &budgetGetter{Getter: getter, sem: o.budget}
+	}
+	j := &joiner{
+		getter: store.New(getter),
+		opts:   o,
+	}
+	j.dataGetter = j.getter
+	if o.dataCache != nil {
+		j.dataGetter = &cachedGetter{chunks: o.dataCache, getter: j.getter}
+	}
+	span, err := j.reset(ctx, address)
 	if err != nil {
 		return nil, 0, err
 	}
+	return j, span, nil
+}
 
-	var chunkData = rootChunk.Data()
+// Resetter is implemented by the joiners returned by New.
+type Resetter interface {
+	// Reset makes the joiner read the data of a different root address,
+	// returning its length, as New does. The eager prefetch, the fetches for
+	// hints and the ones ahead of Read are cancelled, as by Close, and the
+	// chunk cache of the joiner, if any, is not used anymore. It must not be
+	// called concurrently with the reads of the joiner, which must have
+	// returned. If the root chunk cannot be retrieved, the joiner is left
+	// empty.
+	Reset(ctx context.Context, address swarm.Address) (int64, error)
+}
 
-	span := int64(binary.LittleEndian.Uint64(chunkData[:swarm.SpanSize]))
+func (j *joiner) Reset(ctx context.Context, address swarm.Address) (int64, error) {
+	_ = j.Close()
+	j.prefetched, j.window, j.prefetchCancel, j.prefetchDone = nil, nil, nil, nil
+	j.opts.cache, j.opts.dataCache = nil, nil
+	j.dataGetter = j.getter
+	return j.reset(ctx, address)
+}
 
-	j := &joiner{
-		addr:      rootChunk.Address(),
-		refLength: len(address.Bytes()),
-		ctx:       ctx,
-		getter:    getter,
-		span:      span,
-		rootData:  chunkData[swarm.SpanSize:],
+// reset points the joiner at the start of the data of the root address.
+func (j *joiner) reset(ctx context.Context, address swarm.Address) (int64, error) {
+	j.addr = address
+	j.refLength = len(address.Bytes())
+	j.parities = 0
+	j.ctx = ctx
+	j.span = 0
+	j.off = 0
+	j.goodOff = 0
+	j.rootData = nil
+	j.sniffer = nil
+	j.digest = nil
+	j.ahead = nil
+	j.aheadNext = 0
+	j.intermediates = nil
+	if j.opts.cache == nil {
+		j.intermediates = newChunkCache()
+		j.intermediates.limit = intermediateCacheSize
+	}
+	if j.opts.digest != nil {
+		j.opts.digest.Reset()
+		j.digest = &digest{h: j.opts.digest}
 	}
 
-	return j, span, nil
+	var (
+		rootChunk swarm.Chunk
+		chunkData []byte
+		span      int64
+	)
+	for depth := 0; ; depth++ {
+		if address.Equal(emptyAddress) {
+			return 0, nil
+		}
+
+		// retrieve the root chunk to read the total data length the be retrieved
+		start := time.Now()
+		var err error
+		rootChunk, err = getChunk(ctx, j.getter, j.opts.cache, address)
+		if err != nil {
+			j.opts.trace(address, 0, j.refLength, start, err)
+			return 0, err
+		}
+
+		chunkData = rootChunk.Data()
+
+		span = int64(j.opts.spanCodec.DecodeSpan(chunkData[:swarm.SpanSize]))
+		j.opts.trace(address, span, j.refLength, start, nil)
+		if span < 0 {
+			return 0, ErrInvalidSpan
+		}
+
+		// follow the root chunk holding a single reference
+		if depth >= j.opts.indirection || int64(len(chunkData)-swarm.SpanSize) != span || (span != swarm.HashSize && span != encryption.ReferenceSize) {
+			break
+		}
+		address = swarm.NewAddress(append([]byte(nil), chunkData[swarm.SpanSize:]...))
+		j.refLength = len(address.Bytes())
+		if !j.opts.validChunkSize(j.refLength != swarm.HashSize) {
+			return 0, ErrChunkSize
+		}
+	}
+
+	// the intermediate chunks of a trie with redundancy reference parity chunks
+	if p := redundancy.Parities(chunkData[:swarm.SpanSize]); p > 0 && j.refLength == swarm.HashSize && j.opts.spanCodec == file.LittleEndianSpan {
+		span = redundancy.DecodeSpan(chunkData[:swarm.SpanSize])
+		if p > redundancy.MaxParities || j.opts.chunkSize/swarm.HashSize-int64(p) < 2 || len(chunkData)-swarm.SpanSize <= p*swarm.HashSize || span <= j.opts.chunkSize {
+			return 0, ErrInvalidSpan
+		}
+		j.parities = p
+	}
+
+	j.addr = rootChunk.Address()
+	j.span = span
+	j.rootData = chunkData[swarm.SpanSize:]
+
+	if j.opts.sniff {
+		j.sniffer = new(sniffer)
+	}
+	if j.opts.eagerPrefetch {
+		j.startPrefetch()
+	}
+	if j.opts.readAhead > 0 {
+		j.startReadAhead()
+	}
+
+	return span, nil
 }
 
 // Read is called by the consumer to retrieve the joined data.
 // It must be called with a buffer equal to the maximum chunk size.
+// If a read fails, the data read before the failure is returned with the
+// error and the next read continues from the failed offset.
 func (j *joiner) Read(b []byte) (n int, err error) {
-	read, err := j.ReadAt(b, j.off)
-	if err != nil && err != io.EOF {
-		return read, err
+	if j.ahead != nil {
+		j.readAhead(j.off, len(b))
 	}
+	read, err := j.ReadAt(b, j.off)
 
+	if j.digest != nil {
+		j.digest.add(b[:read], j.off)
+	}
+	if j.opts.boundaries != nil {
+		j.reportBoundaries(j.off, j.off+int64(read))
+	}
 	j.off += int64(read)
 	return read, err
 }
 
+// reportBoundaries reports the ends of the data chunks in the range of the
+// data from the offset from, exclusive, to the offset to, inclusive.
+func (j *joiner) reportBoundaries(from, to int64) {
+	size := j.opts.chunkSize
+	for b := (from/size + 1) * size; b <= to; b += size {
+		j.opts.boundaries(b)
+	}
+	if to == j.span && to > from && to%size != 0 {
+		j.opts.boundaries(to)
+	}
+}
+
+// ReadAt reads the data at the offset off into b. If the retrieval of a chunk
+// fails, the number of bytes read contiguously from off before the data of
+// that chunk is returned with the error. ReadAt does not use the offset of
+// Read and Seek, so it may be called concurrently, and only retrieves the
+// chunks on the paths to the data in range, reusing the intermediate chunks
+// retrieved by previous reads.
 func (j *joiner) ReadAt(b []byte, off int64) (read int, err error) {
 	// since offset is int64 and swarm spans are uint64 it means we cannot seek beyond int64 max value
 	if off >= j.span {
 		return 0, io.EOF
 	}
 
-	readLen := int64(cap(b))
+	readLen := int64(len(b))
 	if readLen > j.span-off {
 		readLen = j.span - off
 	}
 	var bytesRead int64
 	var eg errgroup.Group
-	j.readAtOffset(b, j.rootData, 0, j.span, off, 0, readLen, &bytesRead, &eg)
+	failedAt := readLen
+	if j.window != nil {
+		j.window.advance(off)
+	}
+	j.readAtOffset(b, j.addr, j.rootData, 0, j.span, off, 0, readLen, &bytesRead, &failedAt, &eg)
 
 	err = eg.Wait()
+	read = int(atomic.LoadInt64(&bytesRead))
 	if err != nil {
-		return 0, err
+		// only the data before the first failed chunk was read contiguously
+		read = int(failedAt)
+	}
+
+	j.markGood(off + int64(read))
+	if j.sniffer != nil && off < sniffLen {
+		j.sniffer.add(b[:read], off, j.span)
+	}
+	return read, err
+}
+
+// LastGoodOffsetter is implemented by the joiners returned by New.
+type LastGoodOffsetter interface {
+	// LastGoodOffset returns the highest offset of the data up to which a
+	// read succeeded.
+	LastGoodOffset() int64
+}
+
+func (j *joiner) LastGoodOffset() int64 {
+	return atomic.LoadInt64(&j.goodOff)
+}
+
+// ChunkIndexer is implemented by the joiners returned by New.
+type ChunkIndexer interface {
+	// OffsetOfChunk returns the offset in the data of the start of the data
+	// chunk with the index, or -1 if the data has no such chunk.
+	OffsetOfChunk(index int) int64
+	// ChunkOfOffset returns the index of the data chunk holding the byte at
+	// the offset of the data, or -1 if the offset is out of the data. All
+	// the chunks but the last one hold the chunk size of the joiner.
+	ChunkOfOffset(offset int64) int
+}
+
+func (j *joiner) OffsetOfChunk(index int) int64 {
+	off := int64(index) * j.opts.chunkSize
+	if index < 0 || off >= j.span {
+		return -1
+	}
+	return off
+}
+
+func (j *joiner) ChunkOfOffset(offset int64) int {
+	if offset < 0 || offset >= j.span {
+		return -1
+	}
+	return int(offset / j.opts.chunkSize)
+}
+
+// markGood records that the data up to the offset was read.
+func (j *joiner) markGood(off int64) {
+	for {
+		good := atomic.LoadInt64(&j.goodOff)
+		if off <= good || atomic.CompareAndSwapInt64(&j.goodOff, good, off) {
+			return
+		}
 	}
+}
 
-	return int(atomic.LoadInt64(&bytesRead)), nil
+// recordFailure records the failure of a read at the buffer offset, keeping
+// the lowest one.
+func recordFailure(failedAt *int64, bufferOffset int64) {
+	for {
+		f := atomic.LoadInt64(failedAt)
+		if bufferOffset >= f || atomic.CompareAndSwapInt64(failedAt, f, bufferOffset) {
+			return
+		}
+	}
 }
 
-func (j *joiner) readAtOffset(b, data []byte, cur, subTrieSize, off, bufferOffset, bytesToRead int64, bytesRead *int64, eg *errgroup.Group) {
+func (j *joiner) readAtOffset(b []byte, addr swarm.Address, data []byte, cur, subTrieSize, off, bufferOffset, bytesToRead int64, bytesRead, failedAt *int64, eg *errgroup.Group) {
 	// we are at a leaf data chunk
 	if subTrieSize <= int64(len(data)) {
 		dataOffsetStart := off - cur
@@ -106,21 +363,30 @@ func (j *joiner) readAtOffset(b, data []byte, cur, subTrieSize, off, bufferOffse
 		return
 	}
 
-	for cursor := 0; cursor < len(data); cursor += j.refLength {
+	refs := j.dataRefs(data)
+	for cursor := 0; cursor < len(refs); cursor += j.refLength {
 		if bytesToRead == 0 {
 			break
 		}
 
 		// fast forward the cursor
-		sec := subtrieSection(data, cursor, j.refLength, subTrieSize)
-		if cur+sec < off {
+		sec := j.section(refs, cursor, subTrieSize)
+		if cur+sec <= off {
 			cur += sec
 			continue
 		}
 
 		// if we are here it means that we are within the bounds of the data we need to read
-		address := swarm.NewAddress(data[cursor : cursor+j.refLength])
+		address := swarm.NewAddress(refs[cursor : cursor+j.refLength])
+		index := cursor / j.refLength
 		subtrieSpan := sec
+		if j.opts.validateSpans && sec <= 0 {
+			recordFailure(failedAt, bufferOffset)
+			eg.Go(func() error {
+				return &SpanMismatchError{Address: addr}
+			})
+			break
+		}
 		currentReadSize := subtrieSpan - (off - cur) // the size of the subtrie, minus the offset from the start of the trie
 
 		// upper bound alignments
@@ -131,16 +397,55 @@ func (j *joiner) readAtOffset(b, data []byte, cur, subTrieSize, off, bufferOffse
 			currentReadSize = subtrieSpan
 		}
 
+		// the data of the zero chunk is known without retrieving it
+		if subtrieSpan == swarm.ChunkSize && address.Equal(file.ZeroChunkAddress) {
+			zero := b[bufferOffset : bufferOffset+currentReadSize]
+			for i := range zero {
+				zero[i] = 0
+			}
+			atomic.AddInt64(bytesRead, currentReadSize)
+
+			bufferOffset += currentReadSize
+			bytesToRead -= currentReadSize
+			cur += subtrieSpan
+			off = cur
+			continue
+		}
+
 		func(address swarm.Address, b []byte, cur, subTrieSize, off, bufferOffset, bytesToRead int64) {
 			eg.Go(func() error {
-				ch, err := j.getter.Get(j.ctx, storage.ModeGetRequest, address)
+				ch, err := j.getChunk(j.ctx, address, subTrieSize)
+				if err != nil && j.opts.recovery && j.parities > 0 {
+					ch, err = j.recover(j.ctx, data, index, address, err)
+				}
 				if err != nil {
+					recordFailure(failedAt, bufferOffset)
 					return err
 				}
+				if j.window != nil {
+					// release the chunk once the reads moved past its data
+					j.window.hold(address, cur+subTrieSize)
+				}
 
 				chunkData := ch.Data()[8:]
-				subtrieSpan := int64(chunkToSpan(ch.Data()))
-				j.readAtOffset(b, chunkData, cur, subtrieSpan, off, bufferOffset, currentReadSize, bytesRead, eg)
+				subtrieSpan := j.decodeSpan(ch.Data()[:swarm.SpanSize])
+				if j.opts.validateSpans {
+					if err := j.validateSpan(addr, address, chunkData, subTrieSize, subtrieSpan); err != nil {
+						recordFailure(failedAt, bufferOffset)
+						return err
+					}
+				}
+				j.readAtOffset(b, address, chunkData, cur, subtrieSpan, off, bufferOffset, currentReadSize, bytesRead, failedAt, eg)
+
+				// release prefetched data chunks once they are read to the end
+				if subtrieSpan <= int64(len(chunkData)) && off-cur+currentReadSize >= int64(len(chunkData)) {
+					if j.prefetched != nil {
+						j.prefetched.remove(address)
+					}
+					if j.ahead != nil {
+						j.ahead.chunks.remove(address)
+					}
+				}
 				return nil
 			})
 		}(address, b, cur, subtrieSpan, off, bufferOffset, currentReadSize)
@@ -152,8 +457,86 @@ func (j *joiner) readAtOffset(b, data []byte, cur, subTrieSize, off, bufferOffse
 	}
 }
 
+// getChunk retrieves the chunk with the address, covering span bytes of data,
+// through the chunk cache if the chunk is an intermediate one, or through the
+// prefetched chunks.
+func (j *joiner) getChunk(ctx context.Context, address swarm.Address, span int64) (ch swarm.Chunk, err error) {
+	start := time.Now()
+	defer func() {
+		j.opts.trace(address, span, j.refLength, start, err)
+	}()
+
+	getter := j.getter
+	if span <= j.opts.chunkSize {
+		getter = j.dataGetter
+	}
+
+	switch {
+	case span > j.opts.chunkSize && j.opts.cache != nil:
+		return j.opts.cache.get(ctx, getter, address)
+	case j.prefetched != nil:
+		// the prefetch keeps the intermediate chunks it fetches, and the
+		// data chunks until they are read or the reads moved past them
+		return j.prefetched.get(ctx, getter, address)
+	case span > j.opts.chunkSize && j.intermediates != nil:
+		return j.intermediates.get(ctx, getter, address)
+	case j.ahead != nil && span <= j.opts.chunkSize:
+		return j.ahead.chunks.get(ctx, getter, address)
+	}
+	if h := j.hinted(); h != nil {
+		return h.chunks.take(ctx, getter, address)
+	}
+	return getter.Get(ctx, storage.ModeGetRequest, address)
+}
+
+func getChunk(ctx context.Context, getter storage.Getter, cache *chunkCache, address swarm.Address) (swarm.Chunk, error) {
+	if cache == nil {
+		return getter.Get(ctx, storage.ModeGetRequest, address)
+	}
+	return cache.get(ctx, getter, address)
+}
+
+// validateSpan checks that the span of the chunk with the address and data,
+// referenced by the parent chunk, is the one implied by the span of the
+// parent, and that the data of a data chunk is of the length of its span.
+func (j *joiner) validateSpan(parent, address swarm.Address, data []byte, want, span int64) error {
+	if span != want {
+		return &SpanMismatchError{Address: parent}
+	}
+	if span <= j.opts.chunkSize && int64(len(data)) != span {
+		return &SpanMismatchError{Address: address}
+	}
+	return nil
+}
+
 // brute-forces the subtrie size for each of the sections in this intermediate chunk
-func subtrieSection(data []byte, startIdx, refLen int, subtrieSize int64) int64 {
+// section returns the length of the data covered by the subtrie of the
+// reference at the index of the references of an intermediate chunk.
+func (j *joiner) section(refs []byte, startIdx int, subtrieSize int64) int64 {
+	branching := j.opts.chunkSize/int64(j.refLength) - int64(j.parities)
+	return subtrieSection(refs, startIdx, j.refLength, subtrieSize, branching, j.opts.chunkSize)
+}
+
+// decodeSpan returns the length of the data covered by the chunk with the
+// span, without the number of parities of a trie with redundancy.
+func (j *joiner) decodeSpan(span []byte) int64 {
+	if j.parities > 0 {
+		return redundancy.DecodeSpan(span)
+	}
+	return int64(j.opts.spanCodec.DecodeSpan(span))
+}
+
+// dataRefs returns the references of the data of an intermediate chunk,
+// without the references of its parity chunks.
+func (j *joiner) dataRefs(data []byte) []byte {
+	n := len(data) - j.parities*j.refLength
+	if n < 0 {
+		n = 0
+	}
+	return data[:n]
+}
+
+func subtrieSection(data []byte, startIdx, refLen int, subtrieSize, branching, chunkSize int64) int64 {
 	// assume we have a trie of size `y` then we can assume that all of
 	// the forks except for the last one on the right are of equal size
 	// this is due to how the splitter wraps levels.
@@ -163,8 +546,7 @@ func subtrieSection(data []byte, startIdx, refLen int, subtrieSize int64) int64
 	// x is constant (the brute forced value) and l is the size of the last subtrie
 	var (
 		refs       = int64(len(data) / refLen) // how many references in the intermediate chunk
-		branching  = int64(4096 / refLen)      // branching factor is chunkSize divided by reference length
-		branchSize = int64(4096)
+		branchSize = chunkSize
 	)
 	for {
 		whatsLeft := subtrieSize - (branchSize * (refs - 1))
@@ -181,21 +563,59 @@ func subtrieSection(data []byte, startIdx, refLen int, subtrieSize int64) int64
 	return branchSize
 }
 
+// ErrDecryptionKeyLength is returned by New when the key set with
+// WithDecryptionKey is not of the length of encryption keys.
+var ErrDecryptionKeyLength = errors.New("joiner: invalid decryption key length")
+
+// ErrChunkSize is returned by New when the chunk size set with WithChunkSize
+// is not supported.
+var ErrChunkSize = errors.New("joiner: unsupported chunk size")
+
+// ErrInvalidSpan is returned by New when the span of the root chunk does
+// not fit the length of the data a joiner can read, which is the case for
+// content decrypted with a wrong key.
+var ErrInvalidSpan = errors.New("joiner: invalid span")
+
+// ErrSpanMismatch is returned, wrapped in a SpanMismatchError, by the reads of
+// the joiners created WithSpanValidation when the span of a chunk does not
+// match the spans of the chunks it references, or the length of its data.
+var ErrSpanMismatch = errors.New("joiner: span mismatch")
+
+// SpanMismatchError is the error of a chunk of the trie with a span which does
+// not match its content.
+type SpanMismatchError struct {
+	Address swarm.Address
+}
+
+// Unwrap returns ErrSpanMismatch.
+func (e *SpanMismatchError) Unwrap() error {
+	return ErrSpanMismatch
+}
+
+// Error implements standard go error interface.
+func (e *SpanMismatchError) Error() string {
+	return fmt.Sprintf("%v: chunk %s", ErrSpanMismatch, e.Address)
+}
+
+// ErrInvalidChunkRange is returned when a requested range of chunk indices
+// does not overlap with the file.
+var ErrInvalidChunkRange = errors.New("joiner: invalid chunk range")
+
 var errWhence = errors.New("seek: invalid whence")
 var errOffset = errors.New("seek: invalid offset")
 
+// Seek sets the offset of the next Read as io.Seeker does, with offsets
+// relative to the end being negative. Seeking does not retrieve any chunk,
+// the ones on the path to the new offset are retrieved by the next Read.
+// Seeking beyond the end of the data returns io.EOF and leaves the offset
+// unchanged.
 func (j *joiner) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
-	case 0:
-		offset += 0
-	case 1:
+	case io.SeekStart:
+	case io.SeekCurrent:
 		offset += j.off
-	case 2:
-
-		offset = j.span - offset
-		if offset < 0 {
-			return 0, io.EOF
-		}
+	case io.SeekEnd:
+		offset += j.span
 	default:
 		return 0, errWhence
 	}
@@ -208,7 +628,6 @@ func (j *joiner) Seek(offset int64, whence int) (int64, error) {
 	}
 	j.off = offset
 	return offset, nil
-
 }
 
 func (j *joiner) IterateChunkAddresses(fn swarm.AddressIterFunc) error {
@@ -237,16 +656,22 @@ func (j *joiner) processChunkAddresses(ctx context.Context, fn swarm.AddressIter
 
 	var wg sync.WaitGroup
 
+	refs := j.dataRefs(data)
 	for cursor := 0; cursor < len(data); cursor += j.refLength {
 
 		address := swarm.NewAddress(data[cursor : cursor+j.refLength])
 
-		if err := fn(address); err != nil {
+		// report the address of the stored chunk, without the encryption key
+		if err := fn(swarm.NewAddress(address.Bytes()[:swarm.HashSize])); err != nil {
 			return err
 		}
 
-		sec := subtrieSection(data, cursor, j.refLength, subTrieSize)
-		if sec <= 4096 {
+		// the parity chunks do not reference other chunks
+		if cursor >= len(refs) {
+			continue
+		}
+		sec := j.section(refs, cursor, subTrieSize)
+		if sec <= j.opts.chunkSize {
 			continue
 		}
 
@@ -256,13 +681,13 @@ func (j *joiner) processChunkAddresses(ctx context.Context, fn swarm.AddressIter
 			eg.Go(func() error {
 				defer wg.Done()
 
-				ch, err := j.getter.Get(ectx, storage.ModeGetRequest, address)
+				ch, err := j.getChunk(ectx, address, sec)
 				if err != nil {
 					return err
 				}
 
 				chunkData := ch.Data()[8:]
-				subtrieSpan := int64(chunkToSpan(ch.Data()))
+				subtrieSpan := j.decodeSpan(ch.Data()[:swarm.SpanSize])
 
 				return j.processChunkAddresses(ectx, fn, chunkData, subtrieSpan)
 			})
@@ -278,6 +703,163 @@ func (j *joiner) Size() int64 {
 	return j.span
 }
 
-func chunkToSpan(data []byte) uint64 {
-	return binary.LittleEndian.Uint64(data[:8])
+// Size returns the length of the data of the address, as New does, retrieving
+// only its root chunk, which is decrypted for an encrypted reference.
+func Size(ctx context.Context, getter storage.Getter, address swarm.Address) (int64, error) {
+	if address.Equal(emptyAddress) {
+		return 0, nil
+	}
+	ch, err := store.New(getter).Get(ctx, storage.ModeGetRequest, address)
+	if err != nil {
+		return 0, err
+	}
+	span := int64(file.LittleEndianSpan.DecodeSpan(ch.Data()[:swarm.SpanSize]))
+	if p := redundancy.Parities(ch.Data()[:swarm.SpanSize]); p > 0 && p <= redundancy.MaxParities && len(address.Bytes()) == swarm.HashSize {
+		span = redundancy.DecodeSpan(ch.Data()[:swarm.SpanSize])
+	}
+	if span < 0 {
+		return 0, ErrInvalidSpan
+	}
+	return span, nil
+}
+
+// ReadChunkRange returns the concatenated payloads of count consecutive leaf
+// chunks starting at leaf index start of the file referenced by address.
+// The leaves are fetched in parallel, sharing the descent through the
+// intermediate chunks they have in common. The range is truncated at the end
+// of the file.
+func ReadChunkRange(ctx context.Context, getter storage.Getter, address swarm.Address, start, count int) ([]byte, error) {
+	if start < 0 || count <= 0 {
+		return nil, ErrInvalidChunkRange
+	}
+
+	j, span, err := New(ctx, getter, address)
+	if err != nil {
+		return nil, err
+	}
+
+	off := int64(start) * swarm.ChunkSize
+	if off >= span {
+		return nil, ErrInvalidChunkRange
+	}
+
+	l := int64(count) * swarm.ChunkSize
+	if l > span-off {
+		l = span - off
+	}
+
+	b := make([]byte, l)
+	n, err := j.ReadAt(b, off)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// NewSubtreeReader returns a reader over the data covered by the intermediate
+// chunk with the address, which is treated as the root of its own trie. The
+// readers of the subtrees of a file can be used by independent workers to
+// process the segments of the file in parallel.
+func NewSubtreeReader(ctx context.Context, getter storage.Getter, address swarm.Address) (*io.SectionReader, error) {
+	j, span, err := New(ctx, getter, address)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(j, 0, span), nil
+}
+
+// budgetGetter limits the retrievals in progress by acquiring a slot of
+// the semaphore for each of them.
+type budgetGetter struct {
+	storage.Getter
+	sem *semaphore.Weighted
+}
+
+func (g *budgetGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	if err := g.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer g.sem.Release(1)
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+// fallbackGetter retrieves the chunks from the fallback getter when the
+// retrieval from the wrapped getter fails or does not complete in time.
+type fallbackGetter struct {
+	storage.Getter
+	fallback storage.Getter
+	timeout  time.Duration
+}
+
+func (g *fallbackGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	pctx, cancel := context.WithTimeout(ctx, g.timeout)
+	ch, err := g.Getter.Get(pctx, mode, addr)
+	cancel()
+	if err == nil || ctx.Err() != nil {
+		return ch, err
+	}
+	return g.fallback.Get(ctx, mode, addr)
+}
+
+type resilientReader struct {
+	ctx      context.Context
+	j        file.Joiner
+	off      int64
+	retries  int
+	failures int // consecutive failures at the offset
+}
+
+// NewResilient creates a reader over the data referenced by address which,
+// when a read fails, seeks back to the last successfully read offset and
+// retries the read up to retries consecutive times before returning the
+// error. Cancellation of the context is never retried.
+func NewResilient(ctx context.Context, getter storage.Getter, address swarm.Address, retries int) (io.Reader, int64, error) {
+	var (
+		j    file.Joiner
+		span int64
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		j, span, err = New(ctx, getter, address)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &resilientReader{
+		ctx:     ctx,
+		j:       j,
+		retries: retries,
+	}, span, nil
+}
+
+func (r *resilientReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.j.Read(b)
+		r.off += int64(n)
+		if err == nil || err == io.EOF {
+			r.failures = 0
+			return n, err
+		}
+
+		// count the consecutive failures at the same offset
+		if n > 0 {
+			r.failures = 1
+		} else {
+			r.failures++
+		}
+		if r.failures > r.retries || r.ctx.Err() != nil {
+			return n, err
+		}
+		if n > 0 {
+			// the next read retries from the failed offset
+			return n, nil
+		}
+		if _, err := r.j.Seek(r.off, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
 }
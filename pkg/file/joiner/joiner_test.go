@@ -7,6 +7,8 @@ package joiner_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -16,7 +18,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethersphere/bee/pkg/cac"
 	"github.com/ethersphere/bee/pkg/encryption/store"
+	"github.com/ethersphere/bee/pkg/file"
 	"github.com/ethersphere/bee/pkg/file/joiner"
 	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
 	"github.com/ethersphere/bee/pkg/file/splitter"
@@ -24,7 +28,10 @@ import (
 	"github.com/ethersphere/bee/pkg/storage"
 	"github.com/ethersphere/bee/pkg/storage/mock"
 	"github.com/ethersphere/bee/pkg/swarm"
+	"github.com/ethersphere/bee/pkg/swarm/test"
 	"gitlab.com/nolash/go-mockbytes"
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/sync/semaphore"
 )
 
 func TestJoiner_ErrReferenceLength(t *testing.T) {
@@ -36,6 +43,38 @@ func TestJoiner_ErrReferenceLength(t *testing.T) {
 	}
 }
 
+// TestJoinerEmptyFile verifies that the address of a zero-length file is
+// joined into an empty reader even when its root chunk is not stored, while
+// an address that was never stored results in a not found error.
+func TestJoinerEmptyFile(t *testing.T) {
+	ctx := context.Background()
+
+	pipe := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	emptyAddr, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := mock.NewStorer()
+
+	j, l, err := joiner.New(ctx, store, emptyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != 0 || j.Size() != 0 {
+		t.Fatalf("got length %d, want 0", l)
+	}
+	n, err := j.Read(make([]byte, swarm.ChunkSize))
+	if n != 0 || err != io.EOF {
+		t.Fatalf("got read %d, %v, want 0, %v", n, err, io.EOF)
+	}
+
+	_, _, err = joiner.New(ctx, store, test.RandomAddress())
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
 // TestJoinerSingleChunk verifies that a newly created joiner returns the data stored
 // in the store when the reference is one single chunk.
 func TestJoinerSingleChunk(t *testing.T) {
@@ -346,7 +385,7 @@ func TestSeek(t *testing.T) {
 				if exp == 0 {
 					exp = 1
 				}
-				n, err := j.Seek(exp, io.SeekEnd)
+				n, err := j.Seek(-exp, io.SeekEnd)
 				if err != nil {
 					t.Fatalf("seek from end, exp %d size %d error: %v", exp, tc.size, err)
 				}
@@ -375,6 +414,61 @@ func TestSeek(t *testing.T) {
 	}
 }
 
+// TestSeekFetches tests that reading after a seek only retrieves the chunks
+// on the path to the offset, also for encrypted content.
+func TestSeekFetches(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt %v", encrypt), func(t *testing.T) {
+			ctx := context.Background()
+			store := mock.NewStorer()
+
+			size := 200*swarm.ChunkSize + 42
+			addr, data := storeTestFile(t, store, size, encrypt)
+
+			getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+			j, _, err := joiner.New(ctx, getter, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			off := int64(150*swarm.ChunkSize + 100)
+			n, err := j.Seek(off-int64(size), io.SeekEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != off {
+				t.Fatalf("got offset %d, want %d", n, off)
+			}
+
+			got := make([]byte, 10)
+			if _, err := io.ReadFull(j, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data[off:off+10]) {
+				t.Fatal("data mismatch")
+			}
+
+			// the root, one intermediate chunk and one data chunk
+			getter.mu.Lock()
+			fetched := 0
+			for _, c := range getter.counts {
+				fetched += c
+			}
+			getter.mu.Unlock()
+			if fetched != 3 {
+				t.Fatalf("got %d chunks fetched, want 3", fetched)
+			}
+
+			if _, err := j.Seek(1, io.SeekEnd); err != io.EOF {
+				t.Fatalf("got error %v, want %v", err, io.EOF)
+			}
+			if n, err := j.Seek(0, io.SeekCurrent); err != nil || n != off+10 {
+				t.Fatalf("got offset %d, error %v, want %d", n, err, off+10)
+			}
+		})
+	}
+}
+
 // TestPrefetch tests that prefetching chunks is made to fill up the read buffer
 func TestPrefetch(t *testing.T) {
 	seed := time.Now().UnixNano()
@@ -620,6 +714,62 @@ func TestJoinerReadAt(t *testing.T) {
 	}
 }
 
+// TestJoinerReadAtConcurrent tests that concurrent reads of overlapping ranges
+// retrieve each intermediate chunk only once.
+func TestJoinerReadAtConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 200*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+	j, _, err := joiner.New(ctx, getter, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 8)
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			off := int64(i) * 20 * swarm.ChunkSize
+			b := make([]byte, 60*swarm.ChunkSize)
+			n, err := j.ReadAt(b, off)
+			if err != nil && err != io.EOF {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(b[:n], data[off:off+int64(n)]) {
+				errs <- errors.New("data mismatch")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediates := []swarm.Address{addr}
+	for i := swarm.SpanSize; i < len(root.Data()); i += swarm.HashSize {
+		intermediates = append(intermediates, swarm.NewAddress(root.Data()[i:i+swarm.HashSize]))
+	}
+	for _, a := range intermediates {
+		if c := getter.count(a); c != 1 {
+			t.Fatalf("intermediate chunk %s fetched %d times, want 1", a, c)
+		}
+	}
+}
+
 // TestJoinerOneLevel tests the retrieval of two data chunks immediately
 // below the root chunk level.
 func TestJoinerOneLevel(t *testing.T) {
@@ -830,3 +980,1897 @@ func TestJoinerIterateChunkAddresses(t *testing.T) {
 		checkAddressFound(t, foundAddresses, createdAddress)
 	}
 }
+
+// recordingPutter records the addresses of the chunks put.
+type recordingPutter struct {
+	storage.Storer
+	mu    sync.Mutex
+	addrs swarm.AddressSet
+}
+
+func (p *recordingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	p.mu.Lock()
+	for _, ch := range chs {
+		p.addrs.Add(ch.Address())
+	}
+	p.mu.Unlock()
+	return p.Storer.Put(ctx, mode, chs...)
+}
+
+// TestJoinerIterateChunkAddressesEncrypted tests that the addresses of the
+// stored encrypted chunks are iterated.
+func TestJoinerIterateChunkAddressesEncrypted(t *testing.T) {
+	ctx := context.Background()
+	store := &recordingPutter{Storer: mock.NewStorer()}
+
+	addr, _ := storeTestFile(t, store, 100*swarm.ChunkSize+42, true)
+
+	j, _, err := joiner.New(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		found swarm.AddressSet
+	)
+	err = j.IterateChunkAddresses(func(addr swarm.Address) error {
+		mu.Lock()
+		defer mu.Unlock()
+		found.Add(addr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Len() != store.addrs.Len() {
+		t.Fatalf("got %d addresses, want %d", found.Len(), store.addrs.Len())
+	}
+	for _, a := range store.addrs.Slice() {
+		if !found.Has(a) {
+			t.Fatalf("stored chunk %s not iterated", a)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	for _, encrypt := range []bool{false, true} {
+		for _, size := range []int{0, 42, 3*swarm.ChunkSize + 10} {
+			t.Run(fmt.Sprintf("encrypt %v size %d", encrypt, size), func(t *testing.T) {
+				data := make([]byte, size)
+				addr := storeTestData(t, store, data, encrypt)
+
+				getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+				got, err := joiner.Size(ctx, getter, addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != int64(size) {
+					t.Fatalf("got size %d, want %d", got, size)
+				}
+				var retrievals int
+				for _, c := range getter.counts {
+					retrievals += c
+				}
+				if retrievals > 1 {
+					t.Fatalf("got %d retrievals, want at most 1", retrievals)
+				}
+			})
+		}
+	}
+
+	if _, err := joiner.Size(ctx, store, swarm.ZeroAddress); !errors.Is(err, storage.ErrReferenceLength) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrReferenceLength)
+	}
+}
+
+func TestJoinerSpanValidation(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	// a valid trie is read as it is
+	addr, data := storeTestFile(t, store, 130*swarm.ChunkSize+10, false)
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithSpanValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("data mismatch")
+	}
+
+	// an intermediate chunk referencing two data chunks with an inflated span
+	var refs [][]byte
+	for i := 0; i < 2; i++ {
+		ch, err := cac.New(data[i*swarm.ChunkSize : (i+1)*swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Put(ctx, storage.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ch.Address().Bytes())
+	}
+	inflated, chunkData, err := file.IntermediateChunkAddress(2*swarm.ChunkSize+100, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(ctx, storage.ModePutUpload, swarm.NewChunk(inflated, chunkData)); err != nil {
+		t.Fatal(err)
+	}
+
+	j, span, err := joiner.New(ctx, store, inflated, joiner.WithSpanValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = j.ReadAt(make([]byte, span), 0)
+	if !errors.Is(err, joiner.ErrSpanMismatch) {
+		t.Fatalf("got error %v, want %v", err, joiner.ErrSpanMismatch)
+	}
+	var mismatch *joiner.SpanMismatchError
+	if !errors.As(err, &mismatch) || !mismatch.Address.Equal(inflated) {
+		t.Fatalf("got error %v, want span mismatch of chunk %s", err, inflated)
+	}
+}
+
+func TestReadChunkRange(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 300*swarm.ChunkSize + 123
+	addr, data := storeTestFile(t, store, size, false)
+
+	for _, tc := range []struct {
+		start, count int
+	}{
+		{0, 1},
+		{5, 10},
+		{127, 2},
+		{200, 100},
+		{299, 5},
+		{300, 1},
+	} {
+		t.Run(fmt.Sprintf("start %d count %d", tc.start, tc.count), func(t *testing.T) {
+			got, err := joiner.ReadChunkRange(ctx, store, addr, tc.start, tc.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tc.start * swarm.ChunkSize
+			to := from + tc.count*swarm.ChunkSize
+			if to > size {
+				to = size
+			}
+			if !bytes.Equal(got, data[from:to]) {
+				t.Fatal("chunk range data mismatch")
+			}
+		})
+	}
+
+	_, err := joiner.ReadChunkRange(ctx, store, addr, 301, 1)
+	if !errors.Is(err, joiner.ErrInvalidChunkRange) {
+		t.Fatalf("expected ErrInvalidChunkRange, got %v", err)
+	}
+}
+
+// failingGetter fails the first failures gets of the chunk with the given address.
+type failingGetter struct {
+	storage.Getter
+	mu       sync.Mutex
+	addr     swarm.Address
+	failures int
+}
+
+func (g *failingGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	g.mu.Lock()
+	if addr.Equal(g.addr) && g.failures > 0 {
+		g.failures--
+		g.mu.Unlock()
+		return nil, errors.New("transient failure")
+	}
+	g.mu.Unlock()
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func TestResilient(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 10*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	failing, err := cac.New(data[3*swarm.ChunkSize : 4*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		getter := &failingGetter{Getter: store, addr: failing.Address(), failures: 1}
+		r, l, err := joiner.NewResilient(ctx, getter, addr, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l != int64(size) {
+			t.Fatalf("got length %d, want %d", l, size)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("data mismatch")
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		getter := &failingGetter{Getter: store, addr: failing.Address(), failures: 2}
+		r, _, err := joiner.NewResilient(ctx, getter, addr, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+// flagSpan reserves the two most significant bytes of the span for flags.
+type flagSpan struct {
+	flags [2]byte
+}
+
+func (f flagSpan) EncodeSpan(b []byte, length uint64) {
+	binary.LittleEndian.PutUint64(b, length)
+	copy(b[6:], f.flags[:])
+}
+
+func (f flagSpan) DecodeSpan(b []byte) uint64 {
+	s := make([]byte, 8)
+	copy(s, b[:6])
+	return binary.LittleEndian.Uint64(s)
+}
+
+func TestJoinerSpanCodec(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+	codec := flagSpan{flags: [2]byte{0xca, 0xfe}}
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false, builder.WithSpanCodec(codec))
+
+	if defaultAddr := storeTestData(t, mock.NewStorer(), data, false); addr.Equal(defaultAddr) {
+		t.Fatal("custom span codec did not change the address")
+	}
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.Data()[6:8], codec.flags[:]) {
+		t.Fatalf("got root span flags %x, want %x", root.Data()[6:8], codec.flags)
+	}
+
+	j, l, err := joiner.New(ctx, store, addr, joiner.WithSpanCodec(codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != int64(size) {
+		t.Fatalf("got length %d, want %d", l, size)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+// countingGetter counts the retrievals of each chunk.
+type countingGetter struct {
+	storage.Getter
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (g *countingGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	g.mu.Lock()
+	g.counts[addr.String()]++
+	g.mu.Unlock()
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func (g *countingGetter) count(addr swarm.Address) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.counts[addr.String()]
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 200*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+	cache := joiner.NewCache(getter)
+
+	var (
+		wg       sync.WaitGroup
+		releases = make(chan func(), 2)
+		errs     = make(chan error, 2)
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j, _, release, err := cache.Join(ctx, addr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			releases <- release
+			got, err := ioutil.ReadAll(j)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, data) {
+				errs <- errors.New("data mismatch")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(releases)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediates := []swarm.Address{addr}
+	for i := swarm.SpanSize; i < len(root.Data()); i += swarm.HashSize {
+		intermediates = append(intermediates, swarm.NewAddress(root.Data()[i:i+swarm.HashSize]))
+	}
+	for _, a := range intermediates {
+		if c := getter.count(a); c != 1 {
+			t.Fatalf("intermediate chunk %s fetched %d times, want 1", a, c)
+		}
+	}
+
+	if l := cache.Len(); l != 1 {
+		t.Fatalf("got %d cached roots, want 1", l)
+	}
+	for release := range releases {
+		release()
+	}
+	if l := cache.Len(); l != 0 {
+		t.Fatalf("got %d cached roots after release, want 0", l)
+	}
+}
+
+// slowGetter delays each retrieval and keeps track of the retrievals in progress.
+// TestCacheOptions tests that the joiners of a Cache share chunks only with
+// the ones that read the root with the same options.
+func TestCacheOptions(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	addr, _ := storeTestFile(t, store, 3*swarm.ChunkSize, false)
+	cache := joiner.NewCache(store)
+
+	for _, opts := range [][]joiner.Option{
+		nil,
+		{joiner.WithReadAhead(2)},
+		{joiner.WithSpanCodec(flagSpan{flags: [2]byte{0xca, 0xfe}})},
+	} {
+		_, _, release, err := cache.Join(ctx, addr, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+	}
+
+	// the read-ahead does not change how the root is read
+	if l := cache.Len(); l != 2 {
+		t.Fatalf("got %d cached roots, want 2", l)
+	}
+}
+
+// TestCacheDataChunks tests that the data chunks fetched by a joiner of a
+// Cache are not fetched again by the other joiners of the same root.
+func TestCacheDataChunks(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 100 * swarm.ChunkSize
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+	cache := joiner.NewCache(getter)
+
+	for i := 0; i < 2; i++ {
+		j, _, release, err := cache.Join(ctx, addr, joiner.WithEagerPrefetch())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		defer j.Close()
+
+		got, err := ioutil.ReadAll(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("data mismatch")
+		}
+	}
+
+	for i := 0; i < size; i += swarm.ChunkSize {
+		ch, err := cac.New(data[i : i+swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := getter.count(ch.Address()); c != 1 {
+			t.Fatalf("data chunk %d fetched %d times, want 1", i/swarm.ChunkSize, c)
+		}
+	}
+}
+
+// TestCacheCancel tests that cancelling the reads of a joiner of a Cache does
+// not fail the reads of the other joiners waiting for the same chunks.
+func TestCacheCancel(t *testing.T) {
+	store := mock.NewStorer()
+
+	size := 10*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &slowGetter{Getter: store, delay: 100 * time.Millisecond}
+	cache := joiner.NewCache(getter)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancelled, _, release, err := cache.Join(cancelledCtx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	j, _, release, err := cache.Join(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	cancelledErr := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(cancelled)
+		cancelledErr <- err
+	}()
+	// wait for the first data chunk to be requested by the cancelled joiner
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+type slowGetter struct {
+	storage.Getter
+	delay    time.Duration
+	mu       sync.Mutex
+	started  int
+	inflight int
+	max      int // maximum number of retrievals in progress
+}
+
+func (g *slowGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	g.mu.Lock()
+	g.started++
+	g.inflight++
+	if g.inflight > g.max {
+		g.max = g.inflight
+	}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.inflight--
+		g.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(g.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func (g *slowGetter) stats() (started, inflight int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.started, g.inflight
+}
+
+func TestEagerPrefetch(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 300 * swarm.ChunkSize
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &slowGetter{Getter: store, delay: 10 * time.Millisecond}
+	j, _, err := joiner.New(ctx, getter, addr, joiner.WithEagerPrefetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, swarm.ChunkSize)
+	if _, err := io.ReadFull(j, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data[:swarm.ChunkSize]) {
+		t.Fatal("data mismatch")
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	started, inflight := getter.stats()
+	if inflight != 0 {
+		t.Fatalf("got %d retrievals in progress after close", inflight)
+	}
+	// the whole file consists of 300 data chunks and 4 intermediate ones
+	if started >= 304 {
+		t.Fatalf("prefetch was not cancelled, got %d retrievals", started)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if s, _ := getter.stats(); s != started {
+		t.Fatalf("got %d retrievals started after close", s-started)
+	}
+}
+
+func TestJoinerHint(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 200 * swarm.ChunkSize
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+	j, _, err := joiner.New(ctx, getter, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	indices := []int{10, 50, 150}
+	leaves := make([]swarm.Address, len(indices))
+	for i, idx := range indices {
+		ch, err := cac.New(data[idx*swarm.ChunkSize : (idx+1)*swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = ch.Address()
+	}
+
+	// out of range indices are ignored
+	j.(joiner.Hinter).Hint(append(indices, -1, 200))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for i := range leaves {
+		for getter.count(leaves[i]) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("chunk %d was not fetched", indices[i])
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	b := make([]byte, swarm.ChunkSize)
+	for i, idx := range indices {
+		if _, err := j.ReadAt(b, int64(idx*swarm.ChunkSize)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data[idx*swarm.ChunkSize:(idx+1)*swarm.ChunkSize]) {
+			t.Fatalf("chunk %d: data mismatch", idx)
+		}
+		if c := getter.count(leaves[i]); c != 1 {
+			t.Fatalf("chunk %d: got %d retrievals, want 1", idx, c)
+		}
+	}
+}
+
+// TestJoinerHintReadAhead tests that the chunks fetched for hints are not
+// fetched again by the reads of joiners fetching chunks in the background.
+func TestJoinerHintReadAhead(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 200 * swarm.ChunkSize
+	addr, data := storeTestFile(t, store, size, false)
+
+	indices := []int{10, 50, 150}
+	leaves := make([]swarm.Address, len(indices))
+	for i, idx := range indices {
+		ch, err := cac.New(data[idx*swarm.ChunkSize : (idx+1)*swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = ch.Address()
+	}
+
+	for _, tc := range []struct {
+		name string
+		opt  joiner.Option
+	}{
+		{name: "read ahead", opt: joiner.WithReadAhead(4)},
+		{name: "eager prefetch", opt: joiner.WithEagerPrefetch()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+			j, _, err := joiner.New(ctx, getter, addr, tc.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+
+			j.(joiner.Hinter).Hint(indices)
+			deadline := time.Now().Add(5 * time.Second)
+			for i := range leaves {
+				for getter.count(leaves[i]) == 0 {
+					if time.Now().After(deadline) {
+						t.Fatalf("chunk %d was not fetched", indices[i])
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			b := make([]byte, swarm.ChunkSize)
+			for i, idx := range indices {
+				if _, err := j.ReadAt(b, int64(idx*swarm.ChunkSize)); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, data[idx*swarm.ChunkSize:(idx+1)*swarm.ChunkSize]) {
+					t.Fatalf("chunk %d: data mismatch", idx)
+				}
+				if c := getter.count(leaves[i]); c != 1 {
+					t.Fatalf("chunk %d: got %d retrievals, want 1", idx, c)
+				}
+			}
+		})
+	}
+}
+
+// TestJoinerHintMalformed tests that the hints of malformed tries, with an
+// intermediate chunk not covering the data its parent implies, terminate.
+func TestJoinerHintMalformed(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	put := func(span uint64, refs [][]byte) swarm.Address {
+		t.Helper()
+		// the chunks without references are not hashed, as mock stores do
+		// not check the addresses
+		addr, data := test.RandomAddress(), make([]byte, swarm.SpanSize)
+		binary.LittleEndian.PutUint64(data, span)
+		if len(refs) > 0 {
+			var err error
+			if addr, data, err = file.IntermediateChunkAddress(span, refs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := store.Put(ctx, storage.ModePutUpload, swarm.NewChunk(addr, data)); err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	data := testData(2 * swarm.ChunkSize)
+	var leaves [][]byte
+	for i := 0; i < 2; i++ {
+		ch, err := cac.New(data[i*swarm.ChunkSize : (i+1)*swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Put(ctx, storage.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, ch.Address().Bytes())
+	}
+
+	for _, tc := range []struct {
+		name  string
+		child swarm.Address
+	}{
+		{name: "no references", child: put(128*swarm.ChunkSize, nil)},
+		{name: "short span", child: put(2*swarm.ChunkSize, leaves)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the first child is implied to cover 128 data chunks
+			root := put(200*swarm.ChunkSize, [][]byte{tc.child.Bytes(), tc.child.Bytes()})
+			j, _, err := joiner.New(ctx, store, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j.(joiner.Hinter).Hint([]int{5, 100})
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = j.Close()
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("close did not return")
+			}
+		})
+	}
+}
+
+func TestEagerPrefetchReadAll(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 300*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithEagerPrefetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+// TestEagerPrefetchWindow tests that the eager prefetch fetches only the data
+// chunks within its window ahead of the last read.
+func TestEagerPrefetchWindow(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	// three windows of data chunks, under six intermediate chunks
+	size := 3 * joiner.EagerPrefetchWindow * swarm.ChunkSize
+	addr, data := storeTestFile(t, store, size, false)
+
+	getter := &slowGetter{Getter: store}
+	j, _, err := joiner.New(ctx, getter, addr, joiner.WithEagerPrefetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	// the root chunk, the window of data chunks and the two intermediate
+	// chunks above them
+	want := 1 + joiner.EagerPrefetchWindow + 2
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		started, _ := getter.stats()
+		if started >= want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d retrievals, want %d", started, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if started, _ := getter.stats(); started != want {
+		t.Fatalf("got %d retrievals, want %d", started, want)
+	}
+
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+// TestEagerPrefetchIntermediates tests that the reads of a joiner with eager
+// prefetch do not fetch the intermediate chunks it prefetched again, however
+// many there are.
+func TestEagerPrefetchIntermediates(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	// a chunk size of 128 bytes has four references per intermediate chunk,
+	// so that there are more intermediate chunks than the joiner caches
+	const chunkSize = 128
+	var intermediates []swarm.Address
+	addr, data := storeTestFile(t, store, 500*chunkSize+10, false, builder.WithChunkSize(chunkSize), builder.WithChunkRecorder(func(e builder.ChunkEvent) {
+		if e.Level > 0 {
+			intermediates = append(intermediates, e.Address)
+		}
+	}))
+
+	getter := &countingGetter{Getter: store, counts: make(map[string]int)}
+	j, _, err := joiner.New(ctx, getter, addr, joiner.WithChunkSize(chunkSize), joiner.WithEagerPrefetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+	for _, a := range intermediates {
+		if c := getter.count(a); c > 1 {
+			t.Fatalf("intermediate chunk %s fetched %d times, want once", a, c)
+		}
+	}
+}
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	report, err := joiner.Fsck(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 131 data chunks, 2 intermediate chunks and the root chunk
+	if report.Checked != 134 {
+		t.Fatalf("got %d checked chunks, want 134", report.Checked)
+	}
+	if !report.Intact() {
+		t.Fatalf("got missing %v and corrupt %v chunks in an intact file", report.Missing, report.Corrupt)
+	}
+
+	missing, err := cac.New(data[10*swarm.ChunkSize : 11*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(ctx, storage.ModeSetRemove, missing.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt, err := cac.New(data[20*swarm.ChunkSize : 21*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptData := append([]byte(nil), corrupt.Data()...)
+	corruptData[100] ^= 0xff
+	if _, err := store.Put(ctx, storage.ModePutUpload, swarm.NewChunk(corrupt.Address(), corruptData)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = joiner.Fsck(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 134 {
+		t.Fatalf("got %d checked chunks, want 134", report.Checked)
+	}
+	if len(report.Missing) != 1 || !report.Missing[0].Equal(missing.Address()) {
+		t.Fatalf("got missing chunks %v, want %s", report.Missing, missing.Address())
+	}
+	if len(report.Corrupt) != 1 || !report.Corrupt[0].Equal(corrupt.Address()) {
+		t.Fatalf("got corrupt chunks %v, want %s", report.Corrupt, corrupt.Address())
+	}
+}
+
+func TestJoinerLeafHasher(t *testing.T) {
+	ctx := context.Background()
+
+	size := 130*swarm.ChunkSize + 42
+	data := testData(size)
+
+	upload := func(store storage.Putter, opts ...builder.Option) swarm.Address {
+		t.Helper()
+		addr := storeTestData(t, store, data, false, opts...)
+		return addr
+	}
+
+	store := mock.NewStorer()
+	addr := upload(store, builder.WithLeafHasher(sha3.NewLegacyKeccak256))
+	if again := upload(mock.NewStorer(), builder.WithLeafHasher(sha3.NewLegacyKeccak256)); !again.Equal(addr) {
+		t.Fatalf("got address %s, want reproducible %s", again, addr)
+	}
+	if def := upload(mock.NewStorer()); def.Equal(addr) {
+		t.Fatal("custom leaf hasher did not change the address")
+	}
+
+	j, _, err := joiner.New(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+// delayGetter delays the retrieval of a single chunk.
+type delayGetter struct {
+	storage.Getter
+	addr  swarm.Address
+	delay time.Duration
+}
+
+func (g *delayGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	if addr.Equal(g.addr) {
+		time.Sleep(g.delay)
+	}
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func TestJoinerTracer(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	slow, err := cac.New(data[swarm.ChunkSize : 2*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	delay := 50 * time.Millisecond
+	getter := &delayGetter{Getter: store, addr: slow.Address(), delay: delay}
+
+	var (
+		mu     sync.Mutex
+		events = make(map[string]joiner.FetchEvent)
+	)
+	tracer := func(e joiner.FetchEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[e.Address.String()] = e
+	}
+
+	j, _, err := joiner.New(ctx, getter, addr, joiner.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	// the whole file consists of 131 data chunks, 2 intermediate ones and the root
+	if len(events) != 134 {
+		t.Fatalf("got %d traced chunks, want 134", len(events))
+	}
+	if e := events[addr.String()]; e.Level != 2 {
+		t.Fatalf("got root level %d, want 2", e.Level)
+	}
+	for a, e := range events {
+		if a == slow.Address().String() {
+			if e.Level != 0 {
+				t.Fatalf("got level %d for the slow chunk, want 0", e.Level)
+			}
+			if e.Latency < delay {
+				t.Fatalf("got latency %s for the slow chunk, want at least %s", e.Latency, delay)
+			}
+			continue
+		}
+		if e.Latency >= delay {
+			t.Fatalf("got latency %s for chunk %s, want less than %s", e.Latency, a, delay)
+		}
+	}
+}
+
+func TestSubtreeReader(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 200*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := root.Data()[swarm.SpanSize:]
+	if len(refs) != 2*swarm.HashSize {
+		t.Fatalf("got %d references in the root chunk, want 2", len(refs)/swarm.HashSize)
+	}
+
+	var got []byte
+	for i := 0; i < len(refs); i += swarm.HashSize {
+		r, err := joiner.NewSubtreeReader(ctx, store, swarm.NewAddress(refs[i:i+swarm.HashSize]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && r.Size() != 128*swarm.ChunkSize {
+			t.Fatalf("got first subtree size %d, want %d", r.Size(), 128*swarm.ChunkSize)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(b)) != r.Size() {
+			t.Fatalf("got %d bytes, want %d", len(b), r.Size())
+		}
+		got = append(got, b...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestJoinerContentSniffing(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 3*swarm.ChunkSize + 42
+	data := testData(size)
+	copy(data, "\x89PNG\x0D\x0A\x1A\x0A")
+
+	addr := storeTestData(t, store, data, false)
+
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithContentSniffing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := j.(joiner.ContentTyper)
+
+	b := make([]byte, 100)
+	for read := 0; read < 512; read += len(b) {
+		if got := ct.ContentType(); got != "" {
+			t.Fatalf("got content type %q after reading %d bytes, want none", got, read)
+		}
+		if _, err := io.ReadFull(j, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ct.ContentType(); got != "image/png" {
+		t.Fatalf("got content type %q, want %q", got, "image/png")
+	}
+
+	j, _, err = joiner.New(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(j); err != nil {
+		t.Fatal(err)
+	}
+	if got := j.(joiner.ContentTyper).ContentType(); got != "" {
+		t.Fatalf("got content type %q without sniffing, want none", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	if err := joiner.Verify(ctx, store, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt, err := cac.New(data[20*swarm.ChunkSize : 21*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptData := append([]byte(nil), corrupt.Data()...)
+	corruptData[100] ^= 0xff
+	if _, err := store.Put(ctx, storage.ModePutUpload, swarm.NewChunk(corrupt.Address(), corruptData)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = joiner.Verify(ctx, store, addr)
+	var cerr *joiner.CorruptChunkError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want %T", err, cerr)
+	}
+	if !cerr.Address.Equal(corrupt.Address()) {
+		t.Fatalf("got corrupt chunk %s, want %s", cerr.Address, corrupt.Address())
+	}
+}
+
+// TestNewWithValidation tests that the joiners created by NewWithValidation
+// report the address of the first corrupt chunk they retrieve.
+func TestNewWithValidation(t *testing.T) {
+	ctx := context.Background()
+
+	size := 130*swarm.ChunkSize + 42
+	data := testData(size)
+
+	corrupt := func(t *testing.T, store storage.Storer, addr swarm.Address) {
+		t.Helper()
+		ch, err := store.Get(ctx, storage.ModeGetRequest, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corruptData := append([]byte(nil), ch.Data()...)
+		corruptData[swarm.SpanSize] ^= 0xff
+		if _, err := store.Put(ctx, storage.ModePutUpload, swarm.NewChunk(addr, corruptData)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		store := mock.NewStorer()
+		addr := storeTestData(t, store, data, encrypt)
+
+		j, _, err := joiner.NewWithValidation(ctx, store, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("encrypt %v: data mismatch", encrypt)
+		}
+
+		// the stored address of the root chunk, without the key
+		root := swarm.NewAddress(addr.Bytes()[:swarm.HashSize])
+		corrupt(t, store, root)
+		_, _, err = joiner.NewWithValidation(ctx, store, addr)
+		var cerr *joiner.CorruptChunkError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("encrypt %v: got error %v, want %T", encrypt, err, cerr)
+		}
+		if !cerr.Address.Equal(root) {
+			t.Fatalf("encrypt %v: got corrupt chunk %s, want %s", encrypt, cerr.Address, root)
+		}
+	}
+
+	store := mock.NewStorer()
+	addr := storeTestData(t, store, data, false)
+	leaf, err := cac.New(data[20*swarm.ChunkSize : 21*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt(t, store, leaf.Address())
+
+	j, _, err := joiner.NewWithValidation(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, swarm.ChunkSize)
+	if _, err := j.ReadAt(b, 19*swarm.ChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	_, err = j.ReadAt(b, 20*swarm.ChunkSize)
+	var cerr *joiner.CorruptChunkError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want %T", err, cerr)
+	}
+	if !cerr.Address.Equal(leaf.Address()) {
+		t.Fatalf("got corrupt chunk %s, want %s", cerr.Address, leaf.Address())
+	}
+}
+
+func TestJoinerReset(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	upload := func(size int, seed int64) ([]byte, swarm.Address) {
+		t.Helper()
+		data := make([]byte, size)
+		_, _ = mrand.New(mrand.NewSource(seed)).Read(data)
+		addr := storeTestData(t, store, data, false)
+		return data, addr
+	}
+	first, firstAddr := upload(130*swarm.ChunkSize+42, 1)
+	second, secondAddr := upload(3*swarm.ChunkSize+1, 2)
+
+	j, _, err := joiner.New(ctx, store, firstAddr, joiner.WithEagerPrefetch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, first) {
+		t.Fatal("first file data mismatch")
+	}
+
+	r := j.(joiner.Resetter)
+	span, err := r.Reset(ctx, secondAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span != int64(len(second)) || j.Size() != span {
+		t.Fatalf("got span %d and size %d, want %d", span, j.Size(), len(second))
+	}
+	if r.(file.Joiner) != j {
+		t.Fatal("joiner not reused")
+	}
+
+	got, err = ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, second) {
+		t.Fatal("second file data mismatch")
+	}
+
+	if _, err := r.Reset(ctx, test.RandomAddress()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	if n, err := j.Read(make([]byte, swarm.ChunkSize)); n != 0 || err != io.EOF {
+		t.Fatalf("got %d bytes and error %v from an empty joiner, want 0 and EOF", n, err)
+	}
+}
+
+func TestJoinerDigest(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithDigest(sha256.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := j.(joiner.Digester)
+
+	b := make([]byte, swarm.ChunkSize)
+	if _, err := io.ReadFull(j, b); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Digest(); got != nil {
+		t.Fatalf("got digest %x before the end of the data", got)
+	}
+	if _, err := io.Copy(ioutil.Discard, j); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+	if got := d.Digest(); !bytes.Equal(got, want[:]) {
+		t.Fatalf("got digest %x, want %x", got, want)
+	}
+
+	// skipping a part of the data invalidates the digest
+	j, _, err = joiner.New(ctx, store, addr, joiner.WithDigest(sha256.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Seek(swarm.ChunkSize, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, j); err != nil {
+		t.Fatal(err)
+	}
+	if got := j.(joiner.Digester).Digest(); got != nil {
+		t.Fatalf("got digest %x of partially read data", got)
+	}
+}
+
+func TestJoinerFetchBudget(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	const budget = 3
+	var (
+		getter = &slowGetter{Getter: store, delay: time.Millisecond}
+		sem    = semaphore.NewWeighted(budget)
+		wg     sync.WaitGroup
+		errs   = make(chan error, 4)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(prefetch bool) {
+			defer wg.Done()
+			opts := []joiner.Option{joiner.WithFetchBudget(sem)}
+			if prefetch {
+				opts = append(opts, joiner.WithEagerPrefetch())
+			}
+			j, _, err := joiner.New(ctx, getter, addr, opts...)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer j.Close()
+			b := make([]byte, size)
+			if _, err := j.ReadAt(b, 0); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(b, data) {
+				errs <- errors.New("data mismatch")
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	getter.mu.Lock()
+	defer getter.mu.Unlock()
+	if getter.max > budget {
+		t.Fatalf("got %d retrievals in progress, want at most %d", getter.max, budget)
+	}
+	if getter.max < budget {
+		t.Fatalf("got at most %d retrievals in progress, want the whole budget of %d used", getter.max, budget)
+	}
+}
+
+func TestJoinerFallback(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	addr, data := storeTestFile(t, store, 3*swarm.ChunkSize, false)
+
+	// the primary delays a data chunk past the timeout, and lacks another one
+	slow, err := cac.New(data[swarm.ChunkSize : 2*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := cac.New(data[2*swarm.ChunkSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &failingGetter{
+		Getter:   &ctxDelayGetter{Getter: store, addr: slow.Address(), delay: time.Minute},
+		addr:     missing.Address(),
+		failures: 1,
+	}
+	fallback := &countingGetter{Getter: store, counts: make(map[string]int)}
+
+	j, _, err := joiner.New(ctx, primary, addr, joiner.WithFallback(fallback, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	b := make([]byte, len(data))
+	if _, err := io.ReadFull(j, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("data mismatch")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("read took %v", d)
+	}
+	for _, a := range []swarm.Address{slow.Address(), missing.Address()} {
+		if c := fallback.count(a); c != 1 {
+			t.Fatalf("chunk %s: got %d retrievals from the fallback, want 1", a, c)
+		}
+	}
+	if c := fallback.count(addr); c != 0 {
+		t.Fatalf("got %d retrievals of the root chunk from the fallback, want 0", c)
+	}
+}
+
+// ctxDelayGetter delays the retrieval of a chunk until the delay passes or
+// the context is done.
+type ctxDelayGetter struct {
+	storage.Getter
+	addr  swarm.Address
+	delay time.Duration
+}
+
+func (g *ctxDelayGetter) Get(ctx context.Context, mode storage.ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	if addr.Equal(g.addr) {
+		select {
+		case <-time.After(g.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return g.Getter.Get(ctx, mode, addr)
+}
+
+func TestJoinerChunkIndex(t *testing.T) {
+	ctx := context.Background()
+
+	for _, chunkSize := range []int{swarm.ChunkSize, 1024} {
+		t.Run(fmt.Sprintf("chunk size %d", chunkSize), func(t *testing.T) {
+			store := mock.NewStorer()
+			size := 3*chunkSize + 10
+			pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithChunkSize(chunkSize))
+			addr, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(make([]byte, size)), int64(size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, _, err := joiner.New(ctx, store, addr, joiner.WithChunkSize(chunkSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ci := j.(joiner.ChunkIndexer)
+
+			for _, tc := range []struct {
+				index  int
+				offset int64
+			}{
+				{index: 0, offset: 0},
+				{index: 1, offset: int64(chunkSize)},
+				{index: 3, offset: int64(3 * chunkSize)},
+				{index: -1, offset: -1},
+				{index: 4, offset: -1},
+			} {
+				if got := ci.OffsetOfChunk(tc.index); got != tc.offset {
+					t.Fatalf("offset of chunk %d: got %d, want %d", tc.index, got, tc.offset)
+				}
+			}
+
+			for _, tc := range []struct {
+				offset int64
+				index  int
+			}{
+				{offset: 0, index: 0},
+				{offset: int64(chunkSize) - 1, index: 0},
+				{offset: int64(chunkSize) + 5, index: 1},
+				// inside the last partial chunk
+				{offset: int64(3*chunkSize) + 9, index: 3},
+				{offset: int64(size), index: -1},
+				{offset: -1, index: -1},
+			} {
+				if got := ci.ChunkOfOffset(tc.offset); got != tc.index {
+					t.Fatalf("chunk of offset %d: got %d, want %d", tc.offset, got, tc.index)
+				}
+			}
+		})
+	}
+}
+
+func TestJoinerIndirection(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	upload := func(data []byte) swarm.Address {
+		t.Helper()
+		addr := storeTestData(t, store, data, false)
+		return addr
+	}
+
+	data := testData(3*swarm.ChunkSize + 10)
+	root := upload(data)
+	pointer := upload(root.Bytes())
+	pointerToPointer := upload(pointer.Bytes())
+
+	for _, tc := range []struct {
+		name    string
+		address swarm.Address
+		depth   int
+		want    []byte
+	}{
+		{name: "no indirection", address: pointer, want: root.Bytes()},
+		{name: "pointer", address: pointer, depth: 1, want: data},
+		{name: "file", address: root, depth: 1, want: data},
+		{name: "depth exceeded", address: pointerToPointer, depth: 1, want: root.Bytes()},
+		{name: "nested pointers", address: pointerToPointer, depth: 2, want: data},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			j, span, err := joiner.New(ctx, store, tc.address, joiner.WithIndirection(tc.depth))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if span != int64(len(tc.want)) {
+				t.Fatalf("got span %d, want %d", span, len(tc.want))
+			}
+			b, err := ioutil.ReadAll(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tc.want) {
+				t.Fatal("data mismatch")
+			}
+		})
+	}
+}
+
+func TestJoinerDecryptionKey(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, true)
+	key := addr.Bytes()[swarm.HashSize:]
+	wrongKey := make([]byte, len(key))
+	copy(wrongKey, key)
+	wrongKey[0] ^= 0xff
+
+	// the override takes effect over the key of the reference
+	ref := swarm.NewAddress(append(append([]byte(nil), addr.Bytes()[:swarm.HashSize]...), wrongKey...))
+	j, _, err := joiner.New(ctx, store, ref, joiner.WithDecryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	j, _, err = joiner.New(ctx, store, addr, joiner.WithDecryptionKey(wrongKey))
+	if err == nil {
+		got, err = ioutil.ReadAll(j)
+	}
+	if err == nil && bytes.Equal(got, data) {
+		t.Fatal("read with a wrong decryption key succeeded")
+	}
+
+	if _, _, err := joiner.New(ctx, store, addr, joiner.WithDecryptionKey(key[:10])); !errors.Is(err, joiner.ErrDecryptionKeyLength) {
+		t.Fatalf("got error %v, want %v", err, joiner.ErrDecryptionKeyLength)
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	size := 130*swarm.ChunkSize + 42
+	data := testData(size)
+	metadata := []byte(`{"name":"file.bin","type":"application/octet-stream"}`)
+
+	for _, encrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt %t", encrypt), func(t *testing.T) {
+			store := mock.NewStorer()
+
+			addr := storeTestData(t, store, data, encrypt, builder.WithMetadata(metadata))
+
+			content, gotMetadata, err := joiner.ReadMetadata(ctx, store, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gotMetadata, metadata) {
+				t.Fatalf("got metadata %q, want %q", gotMetadata, metadata)
+			}
+
+			j, _, err := joiner.New(ctx, store, content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("data mismatch")
+			}
+
+			// the wrapper is not taken for a reference to follow
+			j, _, err = joiner.New(ctx, store, addr, joiner.WithIndirection(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wrapper, err := ioutil.ReadAll(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := append(append([]byte(nil), file.MetadataWrapperPrefix...), content.Bytes()...); !bytes.HasPrefix(wrapper, want) {
+				t.Fatalf("got wrapper data %x, want prefix %x", wrapper, want)
+			}
+
+			if !encrypt {
+				want := storeTestData(t, mock.NewStorer(), data, false)
+				if !content.Equal(want) {
+					t.Fatalf("got content address %s, want unchanged %s", content, want)
+				}
+				if _, _, err := joiner.ReadMetadata(ctx, store, content); !errors.Is(err, joiner.ErrInvalidMetadataWrapper) {
+					t.Fatalf("got error %v, want %v", err, joiner.ErrInvalidMetadataWrapper)
+				}
+			}
+		})
+	}
+}
+
+func TestJoinerPartialRead(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	missing, err := cac.New(data[50*swarm.ChunkSize : 51*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(ctx, storage.ModeSetRemove, missing.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	j, _, err := joiner.New(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single read across the missing chunk delivers the data before it
+	b := make([]byte, 100*swarm.ChunkSize)
+	n, err := j.ReadAt(b, 10*swarm.ChunkSize+1)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	if want := 40*swarm.ChunkSize - 1; n != want {
+		t.Fatalf("got %d bytes read, want %d", n, want)
+	}
+	if !bytes.Equal(b[:n], data[10*swarm.ChunkSize+1:50*swarm.ChunkSize]) {
+		t.Fatal("data mismatch")
+	}
+
+	got, err := ioutil.ReadAll(j)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	if len(got) != 50*swarm.ChunkSize {
+		t.Fatalf("got %d bytes read, want %d", len(got), 50*swarm.ChunkSize)
+	}
+	if !bytes.Equal(got, data[:len(got)]) {
+		t.Fatal("data mismatch")
+	}
+	if off := j.(joiner.LastGoodOffsetter).LastGoodOffset(); off != 50*swarm.ChunkSize {
+		t.Fatalf("got last good offset %d, want %d", off, 50*swarm.ChunkSize)
+	}
+}
+
+func TestJoinerChunkBoundaries(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	size := 130*swarm.ChunkSize + 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	var boundaries []int64
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithChunkBoundaries(func(offset int64) {
+		boundaries = append(boundaries, offset)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// read with a buffer not aligned to the chunk size
+	var got []byte
+	b := make([]byte, 3000)
+	for {
+		n, err := j.Read(b)
+		got = append(got, b[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := len(got) / swarm.ChunkSize
+		if len(got) == size {
+			want++
+		}
+		if len(boundaries) != want {
+			t.Fatalf("got %d boundaries after reading %d bytes, want %d", len(boundaries), len(got), want)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	if len(boundaries) != 131 {
+		t.Fatalf("got %d boundaries, want 131", len(boundaries))
+	}
+	for i, b := range boundaries[:130] {
+		if b != int64((i+1)*swarm.ChunkSize) {
+			t.Fatalf("got boundary %d at %d, want %d", i, b, (i+1)*swarm.ChunkSize)
+		}
+	}
+	if last := boundaries[130]; last != int64(size) {
+		t.Fatalf("got last boundary %d, want %d", last, size)
+	}
+}
+
+// TestJoinerReadAhead tests that sequential reads fetch the data chunks ahead
+// of them concurrently, up to the depth and the cap of parallel fetches.
+func TestJoinerReadAhead(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	const chunks = 64
+	size := chunks*swarm.ChunkSize - 42
+	addr, data := storeTestFile(t, store, size, false)
+
+	read := func(t *testing.T, depth int) (*slowGetter, time.Duration) {
+		t.Helper()
+		getter := &slowGetter{Getter: store, delay: 10 * time.Millisecond}
+		j, _, err := joiner.New(ctx, getter, addr, joiner.WithReadAhead(depth))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+
+		start := time.Now()
+		got := make([]byte, 0, size)
+		b := make([]byte, swarm.ChunkSize)
+		for {
+			n, err := j.Read(b)
+			got = append(got, b[:n]...)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		elapsed := time.Since(start)
+		if !bytes.Equal(got, data) {
+			t.Fatal("data mismatch")
+		}
+		return getter, elapsed
+	}
+
+	_, sequential := read(t, 0)
+	for _, tc := range []struct {
+		depth    int
+		parallel int
+	}{
+		{depth: 4, parallel: 4},
+		{depth: 32, parallel: 16},
+	} {
+		getter, elapsed := read(t, tc.depth)
+
+		getter.mu.Lock()
+		started, max := getter.started, getter.max
+		getter.mu.Unlock()
+		// the root chunk and every data chunk once
+		if started != chunks+1 {
+			t.Fatalf("depth %d: got %d retrievals, want %d", tc.depth, started, chunks+1)
+		}
+		// the fetches ahead and the one of the read itself
+		if max < tc.parallel || max > tc.parallel+1 {
+			t.Fatalf("depth %d: got at most %d retrievals in progress, want %d", tc.depth, max, tc.parallel)
+		}
+		if elapsed > sequential/2 {
+			t.Fatalf("depth %d: read in %v, not much faster than the %v without read-ahead", tc.depth, elapsed, sequential)
+		}
+	}
+}
+
+// TestJoinerRecovery tests that the joiners WithRecovery reconstruct the
+// chunks of a trie with parity chunks that are lost, up to the number of
+// parities of each intermediate chunk.
+func TestJoinerRecovery(t *testing.T) {
+	ctx := context.Background()
+	store := mock.NewStorer()
+
+	// a trie of four levels, with six chunks of data and two parity chunks
+	// in every intermediate chunk
+	const (
+		chunkSize = 256
+		parities  = 2
+	)
+	size := 6*6*6*chunkSize + 100
+	data := testData(size)
+
+	var (
+		leaves        []swarm.Address
+		intermediates []swarm.Address // of the chunks referencing the leaves
+	)
+	pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false,
+		builder.WithChunkSize(chunkSize),
+		builder.WithRedundancy(parities),
+		builder.WithChunkRecorder(func(e builder.ChunkEvent) {
+			switch e.Level {
+			case 0:
+				leaves = append(leaves, e.Address)
+			case 1:
+				intermediates = append(intermediates, e.Address)
+			}
+		}),
+	)
+	addr, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(data), int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(opts ...joiner.Option) ([]byte, error) {
+		j, span, err := joiner.New(ctx, store, addr, append(opts, joiner.WithChunkSize(chunkSize))...)
+		if err != nil {
+			return nil, err
+		}
+		defer j.Close()
+		if span != int64(size) {
+			t.Fatalf("got span %d, want %d", span, size)
+		}
+		return ioutil.ReadAll(j)
+	}
+	remove := func(addrs ...swarm.Address) {
+		if err := store.Set(ctx, storage.ModeSetRemove, addrs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the trie with parities is read without recovery
+	got, err := read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	// two of the leaves of the first intermediate chunk, and one of the
+	// intermediate chunks with its leaves
+	remove(leaves[0], leaves[3], intermediates[2], leaves[6*5+1])
+	if _, err := read(); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+	got, err = read(joiner.WithRecovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("recovered data mismatch")
+	}
+
+	// more chunks of an intermediate chunk than its parities
+	remove(leaves[5])
+	if _, err := read(joiner.WithRecovery()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+// testData returns size bytes of pseudorandom data, the same for every call.
+func testData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = mrand.New(mrand.NewSource(1)).Read(data)
+	return data
+}
+
+// storeTestData stores the data with a pipeline built with the options,
+// returning its address.
+func storeTestData(t *testing.T, store storage.Putter, data []byte, encrypt bool, opts ...builder.Option) swarm.Address {
+	t.Helper()
+	ctx := context.Background()
+	pipe := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, encrypt, opts...)
+	addr, err := builder.FeedPipeline(ctx, pipe, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// storeTestFile stores size bytes of the data of testData with a pipeline
+// built with the options, returning its address and the data.
+func storeTestFile(t *testing.T, store storage.Putter, size int, encrypt bool, opts ...builder.Option) (swarm.Address, []byte) {
+	t.Helper()
+	data := testData(size)
+	return storeTestData(t, store, data, encrypt, opts...), data
+}
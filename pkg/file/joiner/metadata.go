@@ -0,0 +1,57 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ErrInvalidMetadataWrapper is returned by ReadMetadata when the data of the
+// address is not a metadata wrapper.
+var ErrInvalidMetadataWrapper = errors.New("joiner: invalid metadata wrapper")
+
+// ReadMetadata reads the metadata wrapper of the address, as created by the
+// pipelines built with the metadata option, returning the address of the
+// data and the metadata attached to it. The options apply to the joiners of
+// both the wrapper and the metadata.
+func ReadMetadata(ctx context.Context, getter storage.Getter, address swarm.Address, opts ...Option) (swarm.Address, []byte, error) {
+	refLength := len(address.Bytes())
+	prefix := file.MetadataWrapperPrefix
+	refs, err := readAll(ctx, getter, address, int64(len(prefix)+2*refLength), opts...)
+	if err != nil {
+		return swarm.ZeroAddress, nil, err
+	}
+	if !bytes.HasPrefix(refs, prefix) {
+		return swarm.ZeroAddress, nil, ErrInvalidMetadataWrapper
+	}
+	refs = refs[len(prefix):]
+
+	metadata, err := readAll(ctx, getter, swarm.NewAddress(refs[refLength:]), -1, opts...)
+	if err != nil {
+		return swarm.ZeroAddress, nil, err
+	}
+	return swarm.NewAddress(refs[:refLength]), metadata, nil
+}
+
+// readAll reads the whole data of the address, which must be of the length
+// wantSpan unless it is negative.
+func readAll(ctx context.Context, getter storage.Getter, address swarm.Address, wantSpan int64, opts ...Option) ([]byte, error) {
+	j, span, err := New(ctx, getter, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Close()
+	if wantSpan >= 0 && span != wantSpan {
+		return nil, ErrInvalidMetadataWrapper
+	}
+	return ioutil.ReadAll(j)
+}
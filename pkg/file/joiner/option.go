@@ -0,0 +1,213 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"hash"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+	"golang.org/x/sync/semaphore"
+)
+
+// Option is an optional parameter of the Joiner created by New.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) { f(o) }
+
+type options struct {
+	chunkSize int64
+	spanCodec file.SpanCodec
+	cache     *chunkCache
+	dataCache *chunkCache
+
+	eagerPrefetch  bool
+	readAhead      int
+	sniff          bool
+	digest         hash.Hash
+	budget         *semaphore.Weighted
+	fallback       storage.Getter
+	primaryTimeout time.Duration
+	decryptionKey  []byte
+	indirection    int
+	validateSpans  bool
+	recovery       bool
+	boundaries     func(offset int64)
+	tracer         func(FetchEvent)
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		chunkSize: swarm.ChunkSize,
+		spanCodec: file.LittleEndianSpan,
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// WithChunkSize sets the maximum length of the data of the chunks. It must
+// match the size the content was written with, and be a power of two multiple
+// of swarm.SectionSize, of at least two sections. Other sizes than
+// swarm.ChunkSize are not supported for encrypted content.
+func WithChunkSize(size int) Option {
+	return optionFunc(func(o *options) {
+		o.chunkSize = int64(size)
+	})
+}
+
+// validChunkSize returns true if the chunk size is supported by the joiner.
+func (o *options) validChunkSize(encrypted bool) bool {
+	if encrypted {
+		return o.chunkSize == swarm.ChunkSize
+	}
+	return o.chunkSize >= 2*swarm.SectionSize && o.chunkSize%swarm.SectionSize == 0 && o.chunkSize&(o.chunkSize-1) == 0
+}
+
+// WithSpanCodec sets the codec used to decode chunk spans. It must match
+// the codec the content was written with.
+func WithSpanCodec(c file.SpanCodec) Option {
+	return optionFunc(func(o *options) {
+		o.spanCodec = c
+	})
+}
+
+// withChunkCache makes the joiner retrieve the root and intermediate chunks
+// through the cache, and the data chunks through the data cache.
+func withChunkCache(c, data *chunkCache) Option {
+	return optionFunc(func(o *options) {
+		o.cache = c
+		o.dataCache = data
+	})
+}
+
+// WithEagerPrefetch makes the joiner start fetching all the chunks of the
+// file in parallel as soon as it is created, for content that is likely to
+// be read in full. Only a limited number of data chunks ahead of the offset
+// of the last read are fetched, so that the prefetched data is bounded.
+// Fetches still in progress are cancelled by Close.
+func WithEagerPrefetch() Option {
+	return optionFunc(func(o *options) {
+		o.eagerPrefetch = true
+	})
+}
+
+// WithReadAhead makes Read fetch the depth data chunks following the data it
+// reads in the background, so that sequential reads from a slow store find
+// them retrieved or in progress. At most 16 chunks are
+// fetched at a time. The fetches still in progress are cancelled by Close.
+func WithReadAhead(depth int) Option {
+	return optionFunc(func(o *options) {
+		o.readAhead = depth
+	})
+}
+
+// WithTracer makes the joiner report every chunk retrieval, with its
+// latency, to the tracer. The tracer may be called concurrently.
+func WithTracer(tracer func(FetchEvent)) Option {
+	return optionFunc(func(o *options) {
+		o.tracer = tracer
+	})
+}
+
+// WithContentSniffing makes the joiner detect the content type from the
+// beginning of the data as it is read, available through ContentType.
+func WithContentSniffing() Option {
+	return optionFunc(func(o *options) {
+		o.sniff = true
+	})
+}
+
+// WithDigest makes the joiner hash the data as it is read with Read, using h,
+// providing the digest of the whole data through Digest.
+func WithDigest(h hash.Hash) Option {
+	return optionFunc(func(o *options) {
+		o.digest = h
+	})
+}
+
+// WithFetchBudget makes the joiner acquire a slot of the semaphore for every
+// chunk retrieval, so that the retrievals of all the joiners sharing the
+// semaphore are limited in total. Retrievals wait for a free slot, unless
+// their context is done.
+func WithFetchBudget(sem *semaphore.Weighted) Option {
+	return optionFunc(func(o *options) {
+		o.budget = sem
+	})
+}
+
+// WithFallback makes the joiner retrieve every chunk from the fallback getter
+// when its retrieval from the getter of the joiner fails or does not complete
+// within the timeout, for a fast but unreliable getter backed by a reliable
+// one, like a local cache. The fallback is not limited by the timeout.
+func WithFallback(fallback storage.Getter, timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.fallback = fallback
+		o.primaryTimeout = timeout
+	})
+}
+
+// WithDecryptionKey makes New decrypt the root chunk of the address with the
+// key, overriding the key of an encrypted reference, or reading an
+// unencrypted reference as encrypted with the key. The keys of the other
+// chunks are the ones referenced by the decrypted chunks.
+func WithDecryptionKey(key []byte) Option {
+	return optionFunc(func(o *options) {
+		o.decryptionKey = key
+	})
+}
+
+// WithIndirection makes the joiner follow the root chunks whose data is a
+// single reference, of swarm.HashSize or encryption.ReferenceSize bytes, like
+// pointers to the current version of a file, reading the data of the
+// referenced root instead. At most depth references are followed, after which
+// the data of the root chunk is read as it is. Any data of the length of a
+// reference is taken for a reference as well, unlike the metadata wrappers,
+// which start with file.MetadataWrapperPrefix.
+func WithIndirection(depth int) Option {
+	return optionFunc(func(o *options) {
+		o.indirection = depth
+	})
+}
+
+// WithSpanValidation makes the reads of the joiner check that the span of
+// every chunk of the trie they retrieve is the one implied by the span of the
+// chunk referencing it, and that the data of the data chunks is of the length
+// of their spans, returning a SpanMismatchError for the first chunk found not
+// to match, instead of misreporting the data of a malformed trie.
+func WithSpanValidation() Option {
+	return optionFunc(func(o *options) {
+		o.validateSpans = true
+	})
+}
+
+// WithRecovery makes the reads of the joiner reconstruct the chunks of a trie
+// with parity chunks, written by a pipeline WithRedundancy, that cannot be
+// retrieved, from the other chunks referenced by the same intermediate chunk,
+// its parity chunks included. The reconstructed chunks are checked to hash to
+// their addresses. The joiners read tries with parity chunks with or without
+// recovery.
+func WithRecovery() Option {
+	return optionFunc(func(o *options) {
+		o.recovery = true
+	})
+}
+
+// WithChunkBoundaries makes the joiner report the offset of the end of each
+// data chunk, in the data, once Read delivers the data up to it. The offsets
+// are multiples of the chunk size, except the last one which is the length
+// of the data.
+func WithChunkBoundaries(fn func(offset int64)) Option {
+	return optionFunc(func(o *options) {
+		o.boundaries = fn
+	})
+}
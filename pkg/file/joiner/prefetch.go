@@ -0,0 +1,230 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// eagerPrefetchWorkers is the number of chunks fetched in parallel
+// by the eager prefetch.
+const eagerPrefetchWorkers = 16
+
+// eagerPrefetchWindow is the number of data chunks the eager prefetch
+// fetches ahead of the offset of the last read.
+const eagerPrefetchWindow = 256
+
+// prefetchWindow limits the chunks fetched by the eager prefetch to the ones
+// with data ahead of the offset of the last read, and releases them once the
+// reads moved past their data, so that the prefetched chunks are bounded.
+type prefetchWindow struct {
+	mu     sync.Mutex
+	pos    int64            // offset of the last read
+	size   int64            // length of the data in the window
+	moved  chan struct{}    // closed when pos changes
+	held   map[string]int64 // end offsets of the data of the prefetched chunks
+	chunks *chunkCache
+}
+
+func newPrefetchWindow(chunks *chunkCache, size int64) *prefetchWindow {
+	return &prefetchWindow{
+		size:   size,
+		moved:  make(chan struct{}),
+		held:   make(map[string]int64),
+		chunks: chunks,
+	}
+}
+
+// advance moves the window to the offset, releasing the chunks with data that
+// ends before it.
+func (w *prefetchWindow) advance(off int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if off == w.pos {
+		return
+	}
+	w.pos = off
+	close(w.moved)
+	w.moved = make(chan struct{})
+	for key, end := range w.held {
+		if end <= off {
+			w.chunks.remove(swarm.NewAddress([]byte(key)))
+			delete(w.held, key)
+		}
+	}
+}
+
+// behind reports whether the data that ends at the offset is before the
+// window.
+func (w *prefetchWindow) behind(end int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return end <= w.pos
+}
+
+// wait blocks until the data at the offset is in the window, returning false
+// if the context is done first.
+func (w *prefetchWindow) wait(ctx context.Context, off int64) bool {
+	for {
+		w.mu.Lock()
+		if off < w.pos+w.size {
+			w.mu.Unlock()
+			return true
+		}
+		moved := w.moved
+		w.mu.Unlock()
+
+		select {
+		case <-moved:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// hold records that the cached chunk with the address has data that ends at
+// the offset, releasing it right away if the window already moved past it.
+// A chunk with data at several offsets is released after the last one.
+func (w *prefetchWindow) hold(addr swarm.Address, end int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if end <= w.pos {
+		w.chunks.remove(addr)
+		return
+	}
+	key := addr.ByteString()
+	if end > w.held[key] {
+		w.held[key] = end
+	}
+}
+
+// startPrefetch starts fetching all the chunks of the trie in the background,
+// the data chunks only within the window ahead of the last read.
+func (j *joiner) startPrefetch() {
+	ctx, cancel := context.WithCancel(j.ctx)
+	j.prefetched = newChunkCache()
+	j.window = newPrefetchWindow(j.prefetched, eagerPrefetchWindow*j.opts.chunkSize)
+	j.prefetchCancel = cancel
+	j.prefetchDone = make(chan struct{})
+
+	go func() {
+		defer close(j.prefetchDone)
+
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, eagerPrefetchWorkers)
+		)
+
+		var walk func(data []byte, cur, subTrieSize int64)
+		walk = func(data []byte, cur, subTrieSize int64) {
+			// we are at a leaf data chunk
+			if subTrieSize <= int64(len(data)) {
+				return
+			}
+
+			data = j.dataRefs(data)
+			for cursor := 0; cursor < len(data); cursor += j.refLength {
+				address := swarm.NewAddress(data[cursor : cursor+j.refLength])
+				sec := j.section(data, cursor, subTrieSize)
+				off := cur
+				cur += sec
+
+				// skip the data the reads are past already
+				if j.window.behind(off + sec) {
+					continue
+				}
+				if !j.window.wait(ctx, off) {
+					return
+				}
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					// the reads may have moved past the data while waiting,
+					// fetching and releasing the chunk already
+					if j.window.behind(off + sec) {
+						<-sem
+						return
+					}
+					ch, err := j.getChunk(ctx, address, sec)
+					<-sem
+					if err != nil {
+						return
+					}
+					j.window.hold(address, off+sec)
+					if sec <= j.opts.chunkSize {
+						return
+					}
+
+					walk(ch.Data()[swarm.SpanSize:], off, j.decodeSpan(ch.Data()[:swarm.SpanSize]))
+				}()
+			}
+		}
+
+		walk(j.rootData, 0, j.span)
+		wg.Wait()
+	}()
+}
+
+// startReadAhead prepares the chunks fetched ahead of Read. Their number is
+// limited, so that the chunks fetched ahead of reads that seek elsewhere are
+// eventually evicted.
+func (j *joiner) startReadAhead() {
+	workers := j.opts.readAhead
+	if workers > eagerPrefetchWorkers {
+		workers = eagerPrefetchWorkers
+	}
+	j.ahead = newHints(j.ctx, workers, 2*(j.opts.readAhead+1))
+}
+
+// readAhead fetches in the background the data chunks following the data of a
+// read of n bytes at the offset, up to the read-ahead depth, except the ones
+// already fetched for the previous reads.
+func (j *joiner) readAhead(off int64, n int) {
+	if n == 0 || off >= j.span {
+		return
+	}
+	next := int((off+int64(n)-1)/j.opts.chunkSize) + 1
+	// start over after a seek
+	if j.aheadNext < next || j.aheadNext > next+j.opts.readAhead {
+		j.aheadNext = next
+	}
+	for ; j.aheadNext < next+j.opts.readAhead; j.aheadNext++ {
+		j.fetchLeaf(j.ahead, j.aheadNext)
+	}
+}
+
+// Close cancels the eager prefetch, the fetches for hints and the ones ahead
+// of Read, if any, and waits for them to terminate.
+func (j *joiner) Close() error {
+	j.hintsMu.Lock()
+	h := j.hints
+	j.hints = nil
+	j.hintsMu.Unlock()
+	for _, h := range []*hints{h, j.ahead} {
+		if h != nil {
+			h.cancel()
+			h.wg.Wait()
+		}
+	}
+
+	if j.prefetchCancel == nil {
+		return nil
+	}
+	j.prefetchCancel()
+	<-j.prefetchDone
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/file/pipeline/bmt"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// recover reconstructs the chunk with the index among the chunks referenced by
+// the data of an intermediate chunk, from the other chunks it references. It
+// returns the error of the retrieval of the chunk if it cannot be
+// reconstructed.
+func (j *joiner) recover(ctx context.Context, data []byte, index int, address swarm.Address, fetchErr error) (swarm.Chunk, error) {
+	var (
+		n         = len(data) / j.refLength
+		k         = n - j.parities
+		shardSize = swarm.SpanSize + int(j.opts.chunkSize)
+		shards    = make([][]byte, n)
+	)
+	if k <= 0 {
+		return nil, fetchErr
+	}
+
+	// retrieve the other chunks, until as many as the data chunks are
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		got int
+	)
+	for i := 0; i < n; i++ {
+		if i == index {
+			continue
+		}
+		addr := swarm.NewAddress(data[i*j.refLength : (i+1)*j.refLength])
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			shard := make([]byte, shardSize)
+			if i < k && addr.Equal(file.ZeroChunkAddress) && j.opts.chunkSize == swarm.ChunkSize {
+				// the zero chunk may not be stored
+				j.opts.spanCodec.EncodeSpan(shard[:swarm.SpanSize], swarm.ChunkSize)
+			} else {
+				ch, err := j.getter.Get(ctx, storage.ModeGetRequest, addr)
+				if err != nil {
+					return
+				}
+				copy(shard, ch.Data())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if got < k {
+				shards[i] = shard
+				got++
+				if got == k {
+					cancel()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := redundancy.Reconstruct(shards, k); err != nil {
+		return nil, fetchErr
+	}
+	shard := shards[index]
+	l := redundancy.ChunkLength(shard[:swarm.SpanSize], int(j.opts.chunkSize))
+	if l > len(shard) {
+		return nil, fetchErr
+	}
+
+	// the chunk is checked with the BMT hash of the chunk size of the joiner
+	args := &pipeline.PipeWriteArgs{Data: shard[:l]}
+	if err := bmt.NewSizedBmtWriter(int(j.opts.chunkSize), discardWriter{}).ChainWrite(args); err != nil || !bytes.Equal(args.Ref, address.Bytes()) {
+		return nil, fetchErr
+	}
+	return swarm.NewChunk(address, shard[:l]), nil
+}
+
+// discardWriter ends a pipeline, discarding the writes.
+type discardWriter struct{}
+
+func (discardWriter) ChainWrite(*pipeline.PipeWriteArgs) error { return nil }
+func (discardWriter) Sum() ([]byte, error)                     { return nil, nil }
@@ -0,0 +1,60 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"net/http"
+	"sync"
+)
+
+// sniffLen is the number of bytes considered to sniff the content type,
+// as by http.DetectContentType.
+const sniffLen = 512
+
+// ContentTyper is implemented by the joiners returned by New.
+type ContentTyper interface {
+	// ContentType returns the content type sniffed from the beginning of the
+	// data, once enough of it has been read. It returns an empty string if
+	// it is not known yet, or the joiner was not created WithContentSniffing.
+	ContentType() string
+}
+
+// sniffer accumulates the beginning of the data as it is read to detect
+// its content type.
+type sniffer struct {
+	mu          sync.Mutex
+	buf         []byte
+	contentType string
+}
+
+// add records the data b read at the offset off of the data with the length
+// span, detecting the content type once enough of it has been read.
+func (s *sniffer) add(b []byte, off, span int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.contentType != "" || off > int64(len(s.buf)) || off+int64(len(b)) <= int64(len(s.buf)) {
+		return
+	}
+	b = b[int64(len(s.buf))-off:]
+	if l := sniffLen - len(s.buf); len(b) > l {
+		b = b[:l]
+	}
+	s.buf = append(s.buf, b...)
+
+	if len(s.buf) == sniffLen || int64(len(s.buf)) == span {
+		s.contentType = http.DetectContentType(s.buf)
+		s.buf = nil
+	}
+}
+
+func (j *joiner) ContentType() string {
+	if j.sniffer == nil {
+		return ""
+	}
+	j.sniffer.mu.Lock()
+	defer j.sniffer.mu.Unlock()
+	return j.sniffer.contentType
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package joiner
+
+import (
+	"time"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// FetchEvent describes the retrieval of a single chunk by the joiner.
+type FetchEvent struct {
+	Address swarm.Address
+	// Level is the height of the chunk in the trie, 0 for data chunks.
+	Level   int
+	Latency time.Duration
+	Err     error
+}
+
+// trace reports the retrieval of the chunk with the address, covering span
+// bytes of data, that started at start to the tracer, if one is set.
+func (o *options) trace(address swarm.Address, span int64, refLength int, start time.Time, err error) {
+	if o.tracer == nil {
+		return
+	}
+	o.tracer(FetchEvent{
+		Address: address,
+		Level:   trieLevel(span, refLength, o.chunkSize),
+		Latency: time.Since(start),
+		Err:     err,
+	})
+}
+
+// trieLevel returns the height of a chunk covering span bytes of data
+// in a trie of references with the length refLength.
+func trieLevel(span int64, refLength int, chunkSize int64) int {
+	var (
+		level     int
+		branching = chunkSize / int64(refLength)
+	)
+	for size := chunkSize; size < span; size *= branching {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+	"github.com/ethersphere/manifest/mantaray"
+)
+
+// ErrEmptyPath is returned by MergeManifests for a root without a path.
+var ErrEmptyPath = errors.New("file: empty manifest path")
+
+// MergeManifests saves a mantaray manifest with an entry for each of the
+// paths of roots, referencing the root address of the path, and returns the
+// address of the manifest. The roots may be the addresses of files or of
+// other manifests, which are referenced as they are, without merging their
+// entries. The manifest is saved with the load saver, unencrypted, and is the
+// same for the same roots.
+func MergeManifests(ctx context.Context, ls LoadSaver, roots map[string]swarm.Address) (swarm.Address, error) {
+	paths := make([]string, 0, len(roots))
+	for path := range roots {
+		if path == "" {
+			return swarm.ZeroAddress, ErrEmptyPath
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	trie := mantaray.New()
+	trie.SetObfuscationKey(mantaray.ZeroObfuscationKey)
+	for _, path := range paths {
+		if err := trie.Add(ctx, []byte(path), roots[path].Bytes(), nil, ls); err != nil {
+			return swarm.ZeroAddress, fmt.Errorf("add %s: %w", path, err)
+		}
+	}
+	if err := trie.Save(ctx, ls); err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("save manifest: %w", err)
+	}
+	return swarm.NewAddress(trie.Reference()), nil
+}
@@ -6,8 +6,9 @@ package bmt
 
 import (
 	"errors"
+	"hash"
+	"sync"
 
-	"github.com/ethersphere/bee/pkg/bmtpool"
 	"github.com/ethersphere/bee/pkg/file/pipeline"
 	"github.com/ethersphere/bee/pkg/swarm"
 )
@@ -17,14 +18,24 @@ var (
 )
 
 type bmtWriter struct {
-	next pipeline.ChainWriter
+	chunkSize int
+	hashers   *sync.Pool
+	next      pipeline.ChainWriter
 }
 
 // NewBmtWriter returns a new bmtWriter. Partial writes are not supported.
 // Note: branching factor is the BMT branching factor, not the merkle trie branching factor.
 func NewBmtWriter(next pipeline.ChainWriter) pipeline.ChainWriter {
+	return NewSizedBmtWriter(swarm.ChunkSize, next)
+}
+
+// NewSizedBmtWriter returns a new bmtWriter of chunks of the size, which must
+// be a power of two multiple of swarm.SectionSize, of at least two sections.
+func NewSizedBmtWriter(chunkSize int, next pipeline.ChainWriter) pipeline.ChainWriter {
 	return &bmtWriter{
-		next: next,
+		chunkSize: chunkSize,
+		hashers:   hasherPoolOf(chunkSize),
+		next:      next,
 	}
 }
 
@@ -34,24 +45,54 @@ func (w *bmtWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
 	if len(p.Data) < swarm.SpanSize {
 		return errInvalidData
 	}
-	hasher := bmtpool.Get()
-	err := hasher.SetSpanBytes(p.Data[:swarm.SpanSize])
-	if err != nil {
-		bmtpool.Put(hasher)
-		return err
+	if len(p.Data) > swarm.SpanSize+w.chunkSize {
+		return errInvalidData
 	}
-	_, err = hasher.Write(p.Data[swarm.SpanSize:])
-	if err != nil {
-		bmtpool.Put(hasher)
+	h := w.hashers.Get().(*hasher)
+	p.Ref = make([]byte, swarm.HashSize)
+	h.sum(p.Ref, p.Data[:swarm.SpanSize], p.Data[swarm.SpanSize:])
+	w.hashers.Put(h)
+
+	return w.next.ChainWrite(p)
+}
+
+// sum calls the next writer for the cryptographic sum
+func (w *bmtWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
+
+type hashWriter struct {
+	hasherFn func() hash.Hash
+	next     pipeline.ChainWriter
+}
+
+// NewHashWriter returns a writer that references the data by its digest
+// computed by a hasher returned by hasherFn, instead of its BMT hash. The span
+// is hashed along with the data. It is meant for experimenting with
+// alternative chunk hashes, producing addresses that are not valid content
+// addressed chunk addresses.
+func NewHashWriter(hasherFn func() hash.Hash, next pipeline.ChainWriter) pipeline.ChainWriter {
+	return &hashWriter{
+		hasherFn: hasherFn,
+		next:     next,
+	}
+}
+
+// ChainWrite writes data in chain. It assumes span has been prepended to the data.
+func (w *hashWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	if len(p.Data) < swarm.SpanSize {
+		return errInvalidData
+	}
+	hasher := w.hasherFn()
+	if _, err := hasher.Write(p.Data); err != nil {
 		return err
 	}
 	p.Ref = hasher.Sum(nil)
-	bmtpool.Put(hasher)
 
 	return w.next.ChainWrite(p)
 }
 
 // sum calls the next writer for the cryptographic sum
-func (w *bmtWriter) Sum() ([]byte, error) {
+func (w *hashWriter) Sum() ([]byte, error) {
 	return w.next.Sum()
 }
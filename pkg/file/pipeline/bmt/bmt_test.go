@@ -6,15 +6,19 @@ package bmt_test
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"testing"
 
+	"github.com/ethersphere/bee/pkg/bmtpool"
 	"github.com/ethersphere/bee/pkg/file/pipeline"
 	"github.com/ethersphere/bee/pkg/file/pipeline/bmt"
 	mock "github.com/ethersphere/bee/pkg/file/pipeline/mock"
 	"github.com/ethersphere/bee/pkg/swarm"
+	bmtlegacy "github.com/ethersphere/bmt/legacy"
+	"golang.org/x/crypto/sha3"
 )
 
 // TestStoreWriter tests that store writer stores the provided data and calls the next chain writer.
@@ -100,3 +104,101 @@ func mustDecodeString(t *testing.T, s string) []byte {
 
 	return v
 }
+
+// TestHashWriter tests that the hash writer references data by its digest.
+func TestHashWriter(t *testing.T) {
+	mockChainWriter := mock.NewChainWriter()
+	writer := bmt.NewHashWriter(sha3.NewLegacyKeccak256, mockChainWriter)
+
+	data := make([]byte, 8+11)
+	binary.LittleEndian.PutUint64(data, 11)
+	copy(data[8:], "hello world")
+	args := pipeline.PipeWriteArgs{Data: data}
+
+	if err := writer.ChainWrite(&args); err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	_, _ = h.Write(data)
+	if want := h.Sum(nil); !bytes.Equal(args.Ref, want) {
+		t.Fatalf("ref mismatch. got %x want %x", args.Ref, want)
+	}
+	if calls := mockChainWriter.ChainWriteCalls(); calls != 1 {
+		t.Errorf("wanted 1 ChainWrite call, got %d", calls)
+	}
+
+	err := writer.ChainWrite(&pipeline.PipeWriteArgs{Data: []byte{1}})
+	if !errors.Is(err, bmt.ErrInvalidData) {
+		t.Fatalf("got error %v, want %v", err, bmt.ErrInvalidData)
+	}
+}
+
+// TestBmtWriterPooledHasher tests that the bmt writer produces the same hashes
+// as the pooled BMT hashers for data of any length.
+func TestBmtWriterPooledHasher(t *testing.T) {
+	data := make([]byte, swarm.ChunkSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []int{1, 31, 32, 33, 64, 65, 1000, 2048, 2049, 4095, 4096} {
+		span := make([]byte, swarm.SpanSize)
+		binary.LittleEndian.PutUint64(span, uint64(l))
+
+		h := bmtpool.Get()
+		if err := h.SetSpanBytes(span); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.Write(data[:l]); err != nil {
+			t.Fatal(err)
+		}
+		want := h.Sum(nil)
+		bmtpool.Put(h)
+
+		writer := bmt.NewBmtWriter(mock.NewChainWriter())
+		args := pipeline.PipeWriteArgs{Data: append(span, data[:l]...)}
+		if err := writer.ChainWrite(&args); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(args.Ref, want) {
+			t.Fatalf("length %d: got ref %x, want %x", l, args.Ref, want)
+		}
+	}
+}
+
+// TestSizedBmtWriterLegacyHasher tests that the bmt writers of all the chunk
+// sizes produce the same hashes as the legacy BMT hashers of the same number
+// of segments, for data of any length up to the chunk size, empty included.
+func TestSizedBmtWriterLegacyHasher(t *testing.T) {
+	for chunkSize := 2 * swarm.SectionSize; chunkSize <= 16*swarm.ChunkSize; chunkSize *= 2 {
+		data := make([]byte, chunkSize)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+		pool := bmtlegacy.NewTreePool(swarm.NewHasher, chunkSize/swarm.SectionSize, 1)
+		writer := bmt.NewSizedBmtWriter(chunkSize, mock.NewChainWriter())
+
+		for _, l := range []int{0, 1, swarm.SectionSize - 1, swarm.SectionSize, swarm.SectionSize + 1, chunkSize/2 - 1, chunkSize / 2, chunkSize/2 + 1, chunkSize - 1, chunkSize} {
+			span := make([]byte, swarm.SpanSize)
+			binary.LittleEndian.PutUint64(span, uint64(l))
+
+			h := bmtlegacy.New(pool)
+			if err := h.SetSpanBytes(span); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := h.Write(data[:l]); err != nil {
+				t.Fatal(err)
+			}
+			want := h.Sum(nil)
+
+			args := pipeline.PipeWriteArgs{Data: append(span, data[:l]...)}
+			if err := writer.ChainWrite(&args); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(args.Ref, want) {
+				t.Fatalf("chunk size %d, length %d: got ref %x, want %x", chunkSize, l, args.Ref, want)
+			}
+		}
+	}
+}
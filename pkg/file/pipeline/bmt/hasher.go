@@ -0,0 +1,123 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmt
+
+import (
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// maxLevels is the number of levels of the binary merkle tree of the largest
+// supported chunk.
+const maxLevels = 32
+
+// keccak is a keccak hash state that can be read without copying the state,
+// as it is done by Sum.
+type keccak interface {
+	hash.Hash
+	io.Reader
+}
+
+// zeroHashes are the hashes of the subtrees of zero data, indexed by level.
+var zeroHashes = func() (z [maxLevels + 1][]byte) {
+	k := swarm.NewHasher().(keccak)
+	z[0] = make([]byte, swarm.HashSize)
+	for i := 1; i <= maxLevels; i++ {
+		k.Reset()
+		_, _ = k.Write(z[i-1])
+		_, _ = k.Write(z[i-1])
+		z[i] = make([]byte, swarm.HashSize)
+		_, _ = k.Read(z[i])
+	}
+	return z
+}()
+
+// hasher computes binary merkle tree chunk hashes sequentially, reusing its
+// hash state and tree between chunks so that hashing does not allocate.
+type hasher struct {
+	k      keccak
+	tree   []byte
+	levels int
+}
+
+var (
+	// hasherPool keeps the hashers of chunks of the default size.
+	hasherPool = newHasherPool(swarm.ChunkSize)
+	// hasherPools keeps the pools of hashers of chunks of other sizes.
+	hasherPools sync.Map
+)
+
+func newHasherPool(chunkSize int) *sync.Pool {
+	levels := 0
+	for n := chunkSize / swarm.SectionSize; n > 1; n /= 2 {
+		levels++
+	}
+	return &sync.Pool{
+		New: func() interface{} {
+			return &hasher{
+				k:      swarm.NewHasher().(keccak),
+				tree:   make([]byte, chunkSize),
+				levels: levels,
+			}
+		},
+	}
+}
+
+// hasherPoolOf returns the pool of the hashers of chunks of the size.
+func hasherPoolOf(chunkSize int) *sync.Pool {
+	if chunkSize == swarm.ChunkSize {
+		return hasherPool
+	}
+	if p, ok := hasherPools.Load(chunkSize); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := hasherPools.LoadOrStore(chunkSize, newHasherPool(chunkSize))
+	return p.(*sync.Pool)
+}
+
+// sum returns the hash of the data with the span, writing it to ref.
+// The data must not be longer than the chunk size of the hasher.
+func (h *hasher) sum(ref, span, data []byte) {
+	// as with the pooled hashers, the hash of no data is the root of the
+	// zero tree, without the span
+	if len(data) == 0 {
+		copy(ref, zeroHashes[h.levels])
+		return
+	}
+
+	n := copy(h.tree, data)
+	for i := n; i < len(h.tree); i++ {
+		h.tree[i] = 0
+	}
+
+	// hash the pairs of nodes in place, level by level, using the known
+	// hashes of the subtries past the data
+	for level, width := 1, len(h.tree); level <= h.levels; level, width = level+1, width/2 {
+		for i := 0; i < width; i += 2 * swarm.HashSize {
+			dst := h.tree[i/2 : i/2+swarm.HashSize]
+			if i >= n {
+				copy(dst, zeroHashes[level])
+				continue
+			}
+			h.hash(dst, h.tree[i:i+2*swarm.HashSize])
+		}
+		n = (n + 2*swarm.HashSize - 1) / (2 * swarm.HashSize) * swarm.HashSize
+	}
+
+	h.k.Reset()
+	_, _ = h.k.Write(span)
+	_, _ = h.k.Write(h.tree[:swarm.HashSize])
+	_, _ = h.k.Read(ref)
+}
+
+// hash writes the hash of the pair of nodes b to dst, which may overlap b.
+func (h *hasher) hash(dst, b []byte) {
+	h.k.Reset()
+	_, _ = h.k.Write(b)
+	_, _ = h.k.Read(dst)
+}
@@ -6,44 +6,401 @@ package builder
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethersphere/bee/pkg/encryption"
+	"github.com/ethersphere/bee/pkg/file"
 	"github.com/ethersphere/bee/pkg/file/pipeline"
 	"github.com/ethersphere/bee/pkg/file/pipeline/bmt"
 	enc "github.com/ethersphere/bee/pkg/file/pipeline/encryption"
 	"github.com/ethersphere/bee/pkg/file/pipeline/feeder"
 	"github.com/ethersphere/bee/pkg/file/pipeline/hashtrie"
+	"github.com/ethersphere/bee/pkg/file/pipeline/span"
 	"github.com/ethersphere/bee/pkg/file/pipeline/store"
 	"github.com/ethersphere/bee/pkg/storage"
 	"github.com/ethersphere/bee/pkg/swarm"
 )
 
+// ErrChunkSize is returned by the pipeline when the chunk size set with
+// WithChunkSize is not supported.
+var ErrChunkSize = errors.New("pipeline: unsupported chunk size")
+
+// ErrRedundancy is returned by the pipeline when the redundancy set with
+// WithRedundancy is not supported.
+var ErrRedundancy = errors.New("pipeline: unsupported redundancy")
+
+// ErrSize is returned by the pipeline when the data written to it does not
+// match the size set with WithSize.
+var ErrSize = errors.New("pipeline: data size mismatch")
+
+// ErrNotAbortable is returned by Abort when the pipeline was not built
+// with WithAbort or the underlying putter is not able to remove chunks.
+var ErrNotAbortable = errors.New("pipeline: not abortable")
+
+// RefCountingPutter is a putter that counts the references to its chunks,
+// incrementing the count of a chunk on every put of it. The chunks of a
+// pipeline built WithAbort on a RefCountingPutter are released on Abort,
+// including those that already existed in the store.
+type RefCountingPutter interface {
+	storage.Putter
+	// Release decrements the reference counts of the chunks, removing the
+	// chunks that are not referenced anymore.
+	Release(ctx context.Context, addrs ...swarm.Address) error
+}
+
+// Pipeline is the hashing pipeline returned by NewPipelineBuilder.
+type Pipeline struct {
+	pipeline.Interface
+	putter  storage.Putter // the putter and options it was built with, for Reset
+	opts    *options
+	tracker *trackingPutter
+	bytes   int64  // number of bytes written, accessed atomically
+	buf     []byte // buffer reused by WriteString
+	digest  hash.Hash
+	err     error // returned by all the writes when the options are invalid
+
+	chunkSize int64
+	encrypt   bool
+	trie      pipeline.ChainWriter        // the hash trie writer, for checkpoints
+	newTrie   func() pipeline.ChainWriter // creates the hash tries of the partial sums
+
+	size    int64 // known size of the data, negative if unknown
+	root    []byte
+	rootErr error
+	summed  bool // whether the trie was completed once the data was written
+
+	progress ProgressFunc
+	chunks   *countingPutter // counts the chunks produced, for the progress
+	dedup    *dedupPutter    // puts only the chunks not in the store, if enabled
+	pinner   *pinningPutter  // pins the chunks once Sum succeeds, if enabled
+
+	leafStats *leafStatsWriter
+	parities  int // number of parity chunks of the intermediate chunks
+
+	metadata   []byte                    // metadata attached to the data
+	newSibling func() pipeline.Interface // creates the pipelines of the metadata and its wrapper
+}
+
 // NewPipelineBuilder returns the appropriate pipeline according to the specified parameters
-func NewPipelineBuilder(ctx context.Context, s storage.Putter, mode storage.ModePut, encrypt bool) pipeline.Interface {
+func NewPipelineBuilder(ctx context.Context, s storage.Putter, mode storage.ModePut, encrypt bool, opts ...Option) *Pipeline {
+	return newPipelineBuilder(ctx, s, mode, encrypt, newOptions(opts))
+}
+
+func newPipelineBuilder(ctx context.Context, s storage.Putter, mode storage.ModePut, encrypt bool, o *options) *Pipeline {
+	p := &Pipeline{putter: s, opts: o, digest: o.digest, chunkSize: int64(o.chunkSize), encrypt: encrypt, size: -1, leafStats: o.leafStats}
+	if o.sized {
+		p.size = o.size
+	}
+	if !o.validChunkSize(encrypt) {
+		p.err = ErrChunkSize
+		return p
+	}
+	if !o.validRedundancy(encrypt) {
+		p.err = ErrRedundancy
+		return p
+	}
+	p.parities = o.parities
+	hasser, _ := s.(storage.Hasser)
+	setter, _ := s.(storage.Setter)
+	if o.pin && setter == nil {
+		p.err = ErrNotPinnable
+		return p
+	}
+	if o.abort {
+		_, refCounting := s.(RefCountingPutter)
+		p.tracker = &trackingPutter{Putter: s, all: refCounting}
+		s = p.tracker
+	}
+	if o.deadLetter != nil {
+		s = &deadLetterPutter{Putter: s, retries: o.putRetries, sink: o.deadLetter}
+	}
+	if o.dedup && hasser != nil {
+		p.dedup = &dedupPutter{Putter: s, hasser: hasser, batch: o.dedupBatch}
+		s = p.dedup
+	}
+	if o.progress != nil {
+		p.progress = o.progress
+		p.chunks = &countingPutter{Putter: s}
+		s = p.chunks
+	}
+
+	// the tries of the partial sums are not part of the data
+	p.newTrie = newPartialTrieFunc(ctx, s, mode, encrypt, o)
+	if o.pin {
+		p.pinner = &pinningPutter{Putter: s, setter: setter, ctx: ctx}
+		s = p.pinner
+	}
 	if encrypt {
-		return newEncryptionPipeline(ctx, s, mode)
+		p.trie = newEncryptionHashTrieWriter(ctx, s, mode, o)
+		p.Interface = newEncryptionDataPipeline(ctx, s, mode, o, p.trie)
+	} else {
+		p.trie = newHashTrieWriter(ctx, s, mode, o)
+		p.Interface = newDataPipeline(ctx, s, mode, o, p.trie)
+	}
+
+	if o.metadata != nil {
+		p.metadata = o.metadata
+		// only the options that the addresses depend on, and the chunk tap, apply to
+		// the siblings
+		so := &options{
+			chunkSize:      o.chunkSize,
+			spanCodec:      o.spanCodec,
+			leafHasher:     o.leafHasher,
+			encryptionSeed: o.encryptionSeed,
+			parities:       o.parities,
+			chunkTap:       o.chunkTap,
+		}
+		p.newSibling = func() pipeline.Interface {
+			if encrypt {
+				return newEncryptionPipeline(ctx, s, mode, so)
+			}
+			return newPipeline(ctx, s, mode, so)
+		}
+	}
+	return p
+}
+
+// Write writes the data to the pipeline. Once the context of the pipeline is
+// done, it stops storing chunks and returns an error wrapping the error of the
+// context.
+func (p *Pipeline) Write(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.size >= 0 && atomic.LoadInt64(&p.bytes)+int64(len(b)) > p.size {
+		return 0, ErrSize
+	}
+	n, err := p.Interface.Write(b)
+	total := atomic.AddInt64(&p.bytes, int64(n))
+	if p.digest != nil {
+		_, _ = p.digest.Write(b[:n])
+	}
+	if p.progress != nil && total/p.chunkSize != (total-int64(n))/p.chunkSize {
+		p.reportProgress()
+	}
+	if err == nil && total == p.size && n > 0 {
+		// the last chunks of the data are known, complete the trie right away
+		p.root, p.rootErr = p.Interface.Sum()
+		if p.rootErr == nil {
+			p.rootErr = p.flush()
+		}
+		p.summed = true
+		err = p.rootErr
+	}
+	return n, err
+}
+
+// reportProgress reports the progress of the pipeline to the ProgressFunc.
+func (p *Pipeline) reportProgress() {
+	var deduplicated int64
+	if p.dedup != nil {
+		deduplicated = p.dedup.deduplicated()
+	}
+	p.progress(atomic.LoadInt64(&p.bytes), atomic.LoadInt64(&p.chunks.count), deduplicated)
+}
+
+// flush puts the chunks batched WithDedup.
+func (p *Pipeline) flush() error {
+	if p.dedup == nil {
+		return nil
+	}
+	return p.dedup.flush()
+}
+
+// Digest returns the digest of the data written to the pipeline, computed by
+// the hash of WithDigest. It returns nil if the pipeline was not built
+// WithDigest.
+func (p *Pipeline) Digest() []byte {
+	if p.digest == nil {
+		return nil
+	}
+	return p.digest.Sum(nil)
+}
+
+// WriteString writes the string to the pipeline. It produces the same result
+// as Write with the bytes of the string, without converting the whole string.
+func (p *Pipeline) WriteString(s string) (int, error) {
+	if p.buf == nil {
+		p.buf = make([]byte, swarm.ChunkSize)
+	}
+	var written int
+	for len(s) > 0 {
+		c := copy(p.buf, s)
+		n, err := p.Write(p.buf[:c])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		s = s[c:]
 	}
-	return newPipeline(ctx, s, mode)
+	return written, nil
+}
+
+// Sum returns the address of the data written to the pipeline. If metadata
+// is attached WithMetadata, the metadata is stored as well and the returned
+// address is the one of the wrapper referencing both the data and the
+// metadata. The address returned by an encryption pipeline is the complete
+// encrypted reference of encryption.ReferenceSize bytes, the address of the
+// stored root chunk followed by the key decrypting it, which can be split
+// with encryption.SplitReference.
+func (p *Pipeline) Sum() ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.size >= 0 && atomic.LoadInt64(&p.bytes) != p.size {
+		return nil, ErrSize
+	}
+	root, err := p.root, p.rootErr
+	if !p.summed {
+		root, err = p.Interface.Sum()
+		if err == nil {
+			err = p.flush()
+		}
+	}
+	if err == nil && p.progress != nil {
+		p.reportProgress()
+	}
+	if err != nil || p.metadata == nil {
+		if err == nil {
+			err = p.pin()
+		}
+		return root, err
+	}
+
+	meta, err := p.sum(p.metadata)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	wrapper, err := p.sum(append(append(append([]byte(nil), file.MetadataWrapperPrefix...), root...), meta...))
+	if err != nil {
+		return nil, fmt.Errorf("metadata wrapper: %w", err)
+	}
+	if err := p.flush(); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	if err := p.pin(); err != nil {
+		return nil, err
+	}
+	return wrapper, nil
+}
+
+// pin pins the chunks of the pipeline WithPinOnSuccess.
+func (p *Pipeline) pin() error {
+	if p.pinner == nil {
+		return nil
+	}
+	return p.pinner.pin()
+}
+
+// sum writes the data to a sibling pipeline, returning its address.
+func (p *Pipeline) sum(data []byte) ([]byte, error) {
+	sp := p.newSibling()
+	if _, err := sp.Write(data); err != nil {
+		return nil, err
+	}
+	return sp.Sum()
+}
+
+// ByteCount returns the number of bytes written to the pipeline so far.
+func (p *Pipeline) ByteCount() int64 {
+	return atomic.LoadInt64(&p.bytes)
+}
+
+// Reset discards the data written to the pipeline and its state, so that it
+// can be reused for other data, with the context and the mode of the next
+// writes. The pipeline is then the same as a new one built with the same
+// putter and options, except that the hash of WithDigest is reset and that
+// a restored pipeline starts over from the beginning of the data. The stats
+// of WithLeafStats are reset as well.
+func (p *Pipeline) Reset(ctx context.Context, mode storage.ModePut) {
+	o := p.opts
+	o.firstLeaf = 0
+	if o.digest != nil {
+		o.digest.Reset()
+	}
+	if o.leafStats != nil {
+		o.leafStats = new(leafStatsWriter)
+	}
+	buf := p.buf
+	*p = *newPipelineBuilder(ctx, p.putter, mode, p.encrypt, o)
+	p.buf = buf
+}
+
+// Abort removes all the chunks that were newly stored by the pipeline so far.
+// Chunks that already existed in the store before they were written by the
+// pipeline are left untouched. If the store is a RefCountingPutter, the
+// references of the pipeline to all of its chunks are released instead.
+// Abort may be called instead of Sum, after which the pipeline must not be
+// used anymore.
+func (p *Pipeline) Abort(ctx context.Context) error {
+	if p.tracker == nil {
+		return ErrNotAbortable
+	}
+	var remove func(ctx context.Context, addrs ...swarm.Address) error
+	switch s := p.tracker.Putter.(type) {
+	case RefCountingPutter:
+		remove = s.Release
+	case storage.Setter:
+		remove = func(ctx context.Context, addrs ...swarm.Address) error {
+			return s.Set(ctx, storage.ModeSetRemove, addrs...)
+		}
+	default:
+		return ErrNotAbortable
+	}
+
+	p.tracker.mu.Lock()
+	addrs := p.tracker.addrs
+	p.tracker.addrs = nil
+	p.tracker.mu.Unlock()
+
+	if len(addrs) == 0 {
+		return nil
+	}
+	if err := remove(ctx, addrs...); err != nil {
+		return fmt.Errorf("abort: %w", err)
+	}
+	return nil
 }
 
 // newPipeline creates a standard pipeline that only hashes content with BMT to create
 // a merkle-tree of hashes that represent the given arbitrary size byte stream. Partial
 // writes are supported. The pipeline flow is: Data -> Feeder -> BMT -> Storage -> HashTrie.
-func newPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut) pipeline.Interface {
-	tw := hashtrie.NewHashTrieWriter(swarm.ChunkSize, swarm.Branches, swarm.HashSize, newShortPipelineFunc(ctx, s, mode))
-	lsw := store.NewStoreWriter(ctx, s, mode, tw)
-	b := bmt.NewBmtWriter(lsw)
-	return feeder.NewChunkFeederWriter(swarm.ChunkSize, b)
+func newPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) pipeline.Interface {
+	tw := newHashTrieWriter(ctx, s, mode, o)
+	return newDataPipeline(ctx, s, mode, o, tw)
+}
+
+// newHashTrieWriter creates the hash trie writer of the standard pipeline.
+func newHashTrieWriter(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) pipeline.ChainWriter {
+	if o.parities > 0 {
+		parityFn := func() pipeline.ChainWriter {
+			return bmt.NewSizedBmtWriter(o.chunkSize, store.NewStoreWriter(ctx, s, mode, nil))
+		}
+		return hashtrie.NewRedundantHashTrieWriter(o.chunkSize, o.chunkSize/swarm.HashSize-o.parities, swarm.HashSize, o.parities, o.spanCodec, newShortPipelineFunc(ctx, s, mode, o), parityFn)
+	}
+	return hashtrie.NewHashTrieWriter(o.chunkSize, o.chunkSize/swarm.HashSize, swarm.HashSize, o.spanCodec, newShortPipelineFunc(ctx, s, mode, o))
+}
+
+// newDataPipeline creates the part of the standard pipeline that hashes and
+// stores the data chunks, passing their references to next.
+func newDataPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options, next pipeline.ChainWriter) pipeline.Interface {
+	next = withChunkRecorder(o, swarm.HashSize, true, withLeafIndex(o, withLeafStats(o, next)))
+	lsw := store.NewStoreWriter(ctx, s, mode, next)
+	b := newLeafHashWriter(o, withLeafHook(o, lsw, next))
+	return feeder.NewChunkFeederWriter(o.chunkSize, withSpanCodec(o, withSparse(o, b, next)))
 }
 
 // newShortPipelineFunc returns a constructor function for an ephemeral hashing pipeline
 // needed by the hashTrieWriter.
-func newShortPipelineFunc(ctx context.Context, s storage.Putter, mode storage.ModePut) func() pipeline.ChainWriter {
+func newShortPipelineFunc(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) func() pipeline.ChainWriter {
 	return func() pipeline.ChainWriter {
 		lsw := store.NewStoreWriter(ctx, s, mode, nil)
-		return bmt.NewBmtWriter(lsw)
+		return withChunkRecorder(o, swarm.HashSize, false, bmt.NewSizedBmtWriter(o.chunkSize, lsw))
 	}
 }
 
@@ -52,57 +409,261 @@ func newShortPipelineFunc(ctx context.Context, s storage.Putter, mode storage.Mo
 // writes are supported. The pipeline flow is: Data -> Feeder -> Encryption -> BMT -> Storage -> HashTrie.
 // Note that the encryption writer will mutate the data to contain the encrypted span, but the span field
 // with the unencrypted span is preserved.
-func newEncryptionPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut) pipeline.Interface {
-	tw := hashtrie.NewHashTrieWriter(swarm.ChunkSize, 64, swarm.HashSize+encryption.KeyLength, newShortEncryptionPipelineFunc(ctx, s, mode))
-	lsw := store.NewStoreWriter(ctx, s, mode, tw)
-	b := bmt.NewBmtWriter(lsw)
-	enc := enc.NewEncryptionWriter(encryption.NewChunkEncrypter(), b)
-	return feeder.NewChunkFeederWriter(swarm.ChunkSize, enc)
+func newEncryptionPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) pipeline.Interface {
+	tw := newEncryptionHashTrieWriter(ctx, s, mode, o)
+	return newEncryptionDataPipeline(ctx, s, mode, o, tw)
+}
+
+// newEncryptionHashTrieWriter creates the hash trie writer of the encryption pipeline.
+func newEncryptionHashTrieWriter(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) pipeline.ChainWriter {
+	return hashtrie.NewHashTrieWriter(swarm.ChunkSize, 64, swarm.HashSize+encryption.KeyLength, o.spanCodec, newShortEncryptionPipelineFunc(ctx, s, mode, o))
+}
+
+// newEncryptionDataPipeline creates the part of the encryption pipeline that
+// encrypts, hashes and stores the data chunks, passing their references to next.
+func newEncryptionDataPipeline(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options, next pipeline.ChainWriter) pipeline.Interface {
+	next = withChunkRecorder(o, encryption.ReferenceSize, true, withLeafIndex(o, next))
+	lsw := store.NewStoreWriter(ctx, s, mode, next)
+	b := newLeafHashWriter(o, withLeafHook(o, lsw, next))
+	enc := enc.NewEncryptionWriter(newChunkEncrypter(o), b)
+	return feeder.NewChunkFeederWriter(swarm.ChunkSize, withSpanCodec(o, withPlaintextLeafStats(o, enc)))
 }
 
 // newShortEncryptionPipelineFunc returns a constructor function for an ephemeral hashing pipeline
 // needed by the hashTrieWriter.
-func newShortEncryptionPipelineFunc(ctx context.Context, s storage.Putter, mode storage.ModePut) func() pipeline.ChainWriter {
+func newShortEncryptionPipelineFunc(ctx context.Context, s storage.Putter, mode storage.ModePut, o *options) func() pipeline.ChainWriter {
 	return func() pipeline.ChainWriter {
 		lsw := store.NewStoreWriter(ctx, s, mode, nil)
 		b := bmt.NewBmtWriter(lsw)
-		return enc.NewEncryptionWriter(encryption.NewChunkEncrypter(), b)
+		return withChunkRecorder(o, encryption.ReferenceSize, false, enc.NewEncryptionWriter(newChunkEncrypter(o), b))
+	}
+}
+
+// newChunkEncrypter returns the encrypter of the chunks, which generates
+// random keys unless an encryption seed is set.
+func newChunkEncrypter(o *options) encryption.ChunkEncrypter {
+	if o.encryptionSeed != nil {
+		return encryption.NewSeededChunkEncrypter(o.encryptionSeed)
+	}
+	return encryption.NewChunkEncrypter()
+}
+
+// newLeafHashWriter returns the writer hashing the data chunks, which is
+// the BMT writer unless a custom leaf hasher is set.
+func newLeafHashWriter(o *options, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.leafHasher != nil {
+		return bmt.NewHashWriter(o.leafHasher, next)
+	}
+	return bmt.NewSizedBmtWriter(o.chunkSize, next)
+}
+
+// withSpanCodec prepends a span writer to next if a custom span codec is set.
+func withSpanCodec(o *options, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.spanCodec == file.LittleEndianSpan {
+		return next
+	}
+	return span.NewSpanWriter(o.spanCodec, next)
+}
+
+// withLeafHook returns a writer passing the data chunks to the store writer,
+// or directly to next when the leaf hook decides to skip storing them.
+func withLeafHook(o *options, store, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.leafHook == nil {
+		return store
 	}
+	return &leafHookWriter{hook: o.leafHook, store: store, next: next}
+}
+
+type leafHookWriter struct {
+	hook  LeafHook
+	store pipeline.ChainWriter
+	next  pipeline.ChainWriter
+}
+
+func (w *leafHookWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	skip, err := w.hook(swarm.NewAddress(p.Ref), p.Data)
+	if err != nil {
+		return err
+	}
+	if skip {
+		return w.next.ChainWrite(p)
+	}
+	return w.store.ChainWrite(p)
+}
+
+func (w *leafHookWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
+
+// withLeafIndex prepends a writer reporting the data chunks to the leaf index
+// function to next, if one is set.
+func withLeafIndex(o *options, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.leafIndex == nil {
+		return next
+	}
+	return &leafIndexWriter{fn: o.leafIndex, next: next, index: o.firstLeaf, chunkSize: int64(o.chunkSize)}
+}
+
+type leafIndexWriter struct {
+	fn        LeafIndexFunc
+	next      pipeline.ChainWriter
+	index     int
+	chunkSize int64
+}
+
+func (w *leafIndexWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	ref := make([]byte, 0, len(p.Ref)+len(p.Key))
+	ref = append(append(ref, p.Ref...), p.Key...)
+	w.fn(w.index, int64(w.index)*w.chunkSize, swarm.NewAddress(ref))
+	w.index++
+	return w.next.ChainWrite(p)
+}
+
+func (w *leafIndexWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
+
+// withSparse returns a writer passing the zero data chunks directly to next,
+// except for the first one, if the sparse option is set.
+func withSparse(o *options, hash, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if !o.sparse || o.spanCodec != file.LittleEndianSpan || o.leafHasher != nil || o.chunkSize != swarm.ChunkSize {
+		return hash
+	}
+	return &sparseWriter{hash: hash, next: next}
+}
+
+type sparseWriter struct {
+	hash   pipeline.ChainWriter
+	next   pipeline.ChainWriter
+	stored bool // whether the zero chunk was stored
+}
+
+func (w *sparseWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	if !isZeroChunk(p.Data) {
+		return w.hash.ChainWrite(p)
+	}
+	if !w.stored {
+		if err := w.hash.ChainWrite(p); err != nil {
+			return err
+		}
+		w.stored = true
+		return nil
+	}
+	p.Ref = file.ZeroChunkAddress.Bytes()
+	return w.next.ChainWrite(p)
+}
+
+func (w *sparseWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
+
+// isZeroChunk returns true if data is the span and the data of a full chunk
+// of zero bytes.
+func isZeroChunk(data []byte) bool {
+	if len(data) != swarm.ChunkWithSpanSize {
+		return false
+	}
+	for _, b := range data[swarm.SpanSize:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trackingPutter records the addresses of the chunks that were not present
+// in the wrapped putter before they were put, or of all the chunks put if
+// all is set.
+type trackingPutter struct {
+	storage.Putter
+	all   bool
+	mu    sync.Mutex
+	addrs []swarm.Address
+}
+
+func (t *trackingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	exist, err := t.Putter.Put(ctx, mode, chs...)
+	if err != nil {
+		return exist, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, ch := range chs {
+		if t.all || !exist[i] {
+			t.addrs = append(t.addrs, ch.Address())
+		}
+	}
+	return exist, nil
+}
+
+// deadLetterPutter retries the failed puts, passing the chunks that still
+// cannot be put to the sink instead of failing.
+type deadLetterPutter struct {
+	storage.Putter
+	retries int
+	sink    DeadLetterFunc
+}
+
+func (d *deadLetterPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) (exist []bool, err error) {
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		exist, err = d.Putter.Put(ctx, mode, chs...)
+		if err == nil {
+			return exist, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	for _, ch := range chs {
+		d.sink(ch, err)
+	}
+	return make([]bool, len(chs)), nil
+}
+
+// countingPutter counts the chunks put.
+type countingPutter struct {
+	storage.Putter
+	count int64 // accessed atomically
+}
+
+func (c *countingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	atomic.AddInt64(&c.count, int64(len(chs)))
+	return c.Putter.Put(ctx, mode, chs...)
 }
 
 // FeedPipeline feeds the pipeline with the given reader until EOF is reached.
-// It returns the cryptographic root hash of the content.
+// It returns the cryptographic root hash of the content. The data is read in
+// blocks of the chunk size of the pipeline, so that every write but the last
+// one is a whole chunk, regardless of the sizes of the reads of the reader.
+// The reader must provide at least dataLength bytes, unless dataLength is
+// negative for data of an unknown length.
 func FeedPipeline(ctx context.Context, pipeline pipeline.Interface, r io.Reader, dataLength int64) (addr swarm.Address, err error) {
+	size := swarm.ChunkSize
+	if p, ok := pipeline.(*Pipeline); ok && p.err == nil {
+		size = int(p.chunkSize)
+	}
+
 	var total int64
-	data := make([]byte, swarm.ChunkSize)
+	data := make([]byte, size)
 	for {
-		c, err := r.Read(data)
+		c, err := io.ReadFull(r, data)
 		total += int64(c)
-		if err != nil {
-			if err == io.EOF {
-				if total < dataLength {
-					return swarm.ZeroAddress, fmt.Errorf("pipline short write: read %d out of %d bytes", total, dataLength)
-				}
-				if c > 0 {
-					cc, err := pipeline.Write(data[:c])
-					if err != nil {
-						return swarm.ZeroAddress, err
-					}
-					if cc < c {
-						return swarm.ZeroAddress, fmt.Errorf("pipeline short write: %d mismatches %d", cc, c)
-					}
-				}
-				break
-			} else {
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return swarm.ZeroAddress, err
+		}
+		if c > 0 {
+			cc, err := pipeline.Write(data[:c])
+			if err != nil {
 				return swarm.ZeroAddress, err
 			}
+			if cc < c {
+				return swarm.ZeroAddress, fmt.Errorf("pipeline short write: %d mismatches %d", cc, c)
+			}
 		}
-		cc, err := pipeline.Write(data[:c])
-		if err != nil {
-			return swarm.ZeroAddress, err
-		}
-		if cc < c {
-			return swarm.ZeroAddress, fmt.Errorf("pipeline short write: %d mismatches %d", cc, c)
+		if eof {
+			break
 		}
 		select {
 		case <-ctx.Done():
@@ -110,6 +671,9 @@ func FeedPipeline(ctx context.Context, pipeline pipeline.Interface, r io.Reader,
 		default:
 		}
 	}
+	if total < dataLength {
+		return swarm.ZeroAddress, fmt.Errorf("pipline short write: read %d out of %d bytes", total, dataLength)
+	}
 	select {
 	case <-ctx.Done():
 		return swarm.ZeroAddress, ctx.Err()
@@ -8,12 +8,24 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strconv"
+	"sync"
 	"testing"
+	"testing/iotest"
 
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/encryption"
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/joiner"
 	"github.com/ethersphere/bee/pkg/file/pipeline/builder"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
 	test "github.com/ethersphere/bee/pkg/file/testing"
 	"github.com/ethersphere/bee/pkg/storage"
 	"github.com/ethersphere/bee/pkg/storage/mock"
@@ -56,6 +68,56 @@ func TestHelloWorld(t *testing.T) {
 	}
 }
 
+func TestWriteString(t *testing.T) {
+	m := mock.NewStorer()
+	p := builder.NewPipelineBuilder(context.Background(), m, storage.ModePutUpload, false)
+
+	n, err := p.WriteString("hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 {
+		t.Fatalf("got %d written bytes, want 11", n)
+	}
+
+	sum, err := p.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := swarm.MustParseHexAddress("92672a471f4419b255d7cb0cf313474a6f5856fb347c5ece85fb706d644b630f")
+	if !bytes.Equal(exp.Bytes(), sum) {
+		t.Fatalf("expected %s got %s", exp.String(), hex.EncodeToString(sum))
+	}
+}
+
+func TestByteCount(t *testing.T) {
+	m := mock.NewStorer()
+	p := builder.NewPipelineBuilder(context.Background(), m, storage.ModePutUpload, false)
+
+	var want int64
+	for _, l := range []int{10, swarm.ChunkSize, 3*swarm.ChunkSize + 5, 1} {
+		data := make([]byte, l)
+		if _, err := p.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		want += int64(l)
+		if got := p.ByteCount(); got != want {
+			t.Fatalf("got byte count %d, want %d", got, want)
+		}
+	}
+	if _, err := p.WriteString("hello"); err != nil {
+		t.Fatal(err)
+	}
+	want += 5
+
+	if _, err := p.Sum(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.ByteCount(); got != want {
+		t.Fatalf("got byte count %d, want %d", got, want)
+	}
+}
+
 func TestAllVectors(t *testing.T) {
 	for i := 1; i <= 20; i++ {
 		data, expect := test.GetVector(t, i)
@@ -79,6 +141,83 @@ func TestAllVectors(t *testing.T) {
 	}
 }
 
+func TestAbort(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewStorer()
+
+	data := make([]byte, 10*swarm.ChunkSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store the first chunk in advance, it must survive the abort
+	p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false)
+	existing, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data[:swarm.ChunkSize]), swarm.ChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p = builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false, builder.WithAbort())
+	_, err = p.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []swarm.Address
+	for i := swarm.ChunkSize; i < len(data); i += swarm.ChunkSize {
+		ch, err := cac.New(data[i : i+swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has, _ := m.Has(ctx, ch.Address()); !has {
+			t.Fatalf("chunk %s not stored", ch.Address())
+		}
+		stored = append(stored, ch.Address())
+	}
+
+	if err := p.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range stored {
+		if has, _ := m.Has(ctx, addr); has {
+			t.Fatalf("chunk %s not removed", addr)
+		}
+	}
+	if has, _ := m.Has(ctx, existing); !has {
+		t.Fatal("previously existing chunk removed")
+	}
+
+	p = builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false)
+	if err := p.Abort(ctx); !errors.Is(err, builder.ErrNotAbortable) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrNotAbortable)
+	}
+}
+
+// TestPipelineAllocs tests that hashing and storing the chunks allocates only
+// a few objects per chunk.
+func TestPipelineAllocs(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 100*swarm.ChunkSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+		if _, err := p.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Sum(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if max := float64(20 * 100); allocs > max {
+		t.Fatalf("got %v allocations, want at most %v", allocs, max)
+	}
+}
+
 /*
 go test -v -bench=. -run Bench -benchmem
 goos: linux
@@ -86,19 +225,19 @@ goarch: amd64
 pkg: github.com/ethersphere/bee/pkg/file/pipeline/builder
 BenchmarkPipeline
 BenchmarkPipeline/1000-bytes
-BenchmarkPipeline/1000-bytes-4         	   14475	     75170 ns/op	   63611 B/op	     333 allocs/op
+BenchmarkPipeline/1000-bytes-4         	   44647	     33044 ns/op	    2346 B/op	      13 allocs/op
 BenchmarkPipeline/10000-bytes
-BenchmarkPipeline/10000-bytes-4        	    2775	    459275 ns/op	  321825 B/op	    1826 allocs/op
+BenchmarkPipeline/10000-bytes-4        	    6654	    205701 ns/op	   10334 B/op	      51 allocs/op
 BenchmarkPipeline/100000-bytes
-BenchmarkPipeline/100000-bytes-4       	     334	   3523558 ns/op	 1891672 B/op	   11994 allocs/op
+BenchmarkPipeline/100000-bytes-4       	     699	   1678276 ns/op	   27973 B/op	     284 allocs/op
 BenchmarkPipeline/1000000-bytes
-BenchmarkPipeline/1000000-bytes-4      	      36	  33140883 ns/op	17745116 B/op	  114170 allocs/op
+BenchmarkPipeline/1000000-bytes-4      	      70	  20807207 ns/op	  243821 B/op	    2545 allocs/op
 BenchmarkPipeline/10000000-bytes
-BenchmarkPipeline/10000000-bytes-4     	       4	 304759595 ns/op	175378648 B/op	 1135082 allocs/op
+BenchmarkPipeline/10000000-bytes-4     	       4	 344436150 ns/op	 2256140 B/op	   24982 allocs/op
 BenchmarkPipeline/100000000-bytes
-BenchmarkPipeline/100000000-bytes-4    	       1	3064439098 ns/op	1751509528 B/op	11342736 allocs/op
+BenchmarkPipeline/100000000-bytes-4    	       1	3225625907 ns/op	21280008 B/op	  249095 allocs/op
 PASS
-ok  	github.com/ethersphere/bee/pkg/file/pipeline/builder	17.599s
+ok  	github.com/ethersphere/bee/pkg/file/pipeline/builder	31.884s
 
 */
 func BenchmarkPipeline(b *testing.B) {
@@ -140,3 +279,1740 @@ func benchmarkPipeline(b *testing.B, count int) {
 		b.Fatal(err)
 	}
 }
+
+func TestLeafHook(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 10*swarm.ChunkSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	want, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// skip every other data chunk
+	skipped := make(map[string]bool)
+	for i := 0; i < 10*swarm.ChunkSize; i += 2 * swarm.ChunkSize {
+		ch, err := cac.New(data[i : i+swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipped[ch.Address().String()] = true
+	}
+	var leaves int
+	hook := func(addr swarm.Address, _ []byte) (bool, error) {
+		leaves++
+		return skipped[addr.String()], nil
+	}
+
+	m := mock.NewStorer()
+	p = builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false, builder.WithLeafHook(hook))
+	got, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got address %s, want %s", got, want)
+	}
+	if leaves != 11 {
+		t.Fatalf("got %d leaves, want 11", leaves)
+	}
+
+	for i := 0; i < len(data); i += swarm.ChunkSize {
+		end := i + swarm.ChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		ch, err := cac.New(data[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		has, err := m.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has == skipped[ch.Address().String()] {
+			t.Fatalf("chunk %d: got stored %t, want %t", i/swarm.ChunkSize, has, !has)
+		}
+	}
+	if has, _ := m.Has(ctx, got); !has {
+		t.Fatal("root chunk not stored")
+	}
+
+	errHook := errors.New("hook")
+	p = builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false, builder.WithLeafHook(func(swarm.Address, []byte) (bool, error) {
+		return false, errHook
+	}))
+	if _, err := p.Write(data[:swarm.ChunkSize+1]); !errors.Is(err, errHook) {
+		t.Fatalf("got error %v, want %v", err, errHook)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	ctx := context.Background()
+
+	shardSize := 130 * swarm.ChunkSize
+	data := make([]byte, 4*shardSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	want, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := mock.NewStorer()
+	sp := builder.NewSharded(ctx, m, storage.ModePutUpload, false, 4)
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		end := (i + 1) * shardSize
+		if i == 3 {
+			end = len(data)
+		}
+		w, err := sp.Shard(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(w io.Writer, b []byte) {
+			defer wg.Done()
+			_, err := io.Copy(w, bytes.NewReader(b))
+			errs <- err
+		}(w, data[i*shardSize:end])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := sp.Combine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got address %s, want %s", got, want)
+	}
+	if has, _ := m.Has(ctx, got); !has {
+		t.Fatal("root chunk not stored")
+	}
+
+	if _, err := sp.Shard(4); !errors.Is(err, builder.ErrShardIndex) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrShardIndex)
+	}
+
+	sp = builder.NewSharded(ctx, mock.NewStorer(), storage.ModePutUpload, false, 2)
+	for i := 0; i < 2; i++ {
+		w, _ := sp.Shard(i)
+		if _, err := w.Write(data[:swarm.ChunkSize+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sp.Combine(); !errors.Is(err, builder.ErrShardAlignment) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrShardAlignment)
+	}
+}
+
+// TestShardedPutOptions tests that the options of the puts of the chunks apply
+// to the shards of a sharded pipeline.
+func TestShardedPutOptions(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 20*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	want, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(s storage.Putter, opts ...builder.Option) swarm.Address {
+		t.Helper()
+		sp := builder.NewSharded(ctx, s, storage.ModePutUpload, false, 2, opts...)
+		for i, b := range [][]byte{data[:10*swarm.ChunkSize], data[10*swarm.ChunkSize:]} {
+			w, err := sp.Shard(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		addr, err := sp.Combine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !addr.Equal(want) {
+			t.Fatalf("got address %s, want %s", addr, want)
+		}
+		return addr
+	}
+
+	store := &hasCountingStore{countingPutter: &countingPutter{Storer: mock.NewStorer()}}
+	upload(store)
+	for _, batch := range []int{1, 8} {
+		store.puts = 0
+		upload(store, builder.WithDedup(batch))
+		if store.puts != 0 {
+			t.Fatalf("batch %d: got %d chunks put, want 0", batch, store.puts)
+		}
+	}
+
+	failing, err := cac.New(data[3*swarm.ChunkSize : 4*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dead []swarm.Chunk
+	s := &failingPutter{Storer: mock.NewStorer(), addr: failing.Address()}
+	addr := upload(s, builder.WithDeadLetter(1, func(ch swarm.Chunk, _ error) {
+		dead = append(dead, ch)
+	}))
+	if len(dead) != 1 || !dead[0].Address().Equal(failing.Address()) {
+		t.Fatalf("got dead letter chunks %v, want %s", dead, failing.Address())
+	}
+	if has, _ := s.Has(ctx, addr); !has {
+		t.Fatal("root chunk not stored")
+	}
+}
+
+func TestEncryptionSeed(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 130*swarm.ChunkSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := []byte("seed")
+
+	upload := func(m storage.Putter, opts ...builder.Option) swarm.Address {
+		t.Helper()
+		p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, true, opts...)
+		if _, err := p.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := p.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return swarm.NewAddress(sum)
+	}
+
+	m := mock.NewStorer()
+	addr := upload(m, builder.WithEncryptionSeed(seed))
+	if again := upload(mock.NewStorer(), builder.WithEncryptionSeed(seed)); !again.Equal(addr) {
+		t.Fatalf("got address %s, want reproducible %s", again, addr)
+	}
+	if other := upload(mock.NewStorer(), builder.WithEncryptionSeed([]byte("other"))); other.Equal(addr) {
+		t.Fatal("different seeds resulted in the same address")
+	}
+	if upload(mock.NewStorer()).Equal(upload(mock.NewStorer())) {
+		t.Fatal("random keys resulted in the same address")
+	}
+
+	j, _, err := joiner.New(ctx, m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+// refCountingStore is a store that counts the references to its chunks.
+type refCountingStore struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *refCountingStore) Put(_ context.Context, _ storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exist := make([]bool, len(chs))
+	for i, ch := range chs {
+		exist[i] = s.counts[ch.Address().String()] > 0
+		s.counts[ch.Address().String()]++
+	}
+	return exist, nil
+}
+
+func (s *refCountingStore) Release(_ context.Context, addrs ...swarm.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, addr := range addrs {
+		if s.counts[addr.String()]--; s.counts[addr.String()] <= 0 {
+			delete(s.counts, addr.String())
+		}
+	}
+	return nil
+}
+
+func (s *refCountingStore) count(addr swarm.Address) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[addr.String()]
+}
+
+func TestAbortRefCounting(t *testing.T) {
+	ctx := context.Background()
+	s := &refCountingStore{counts: make(map[string]int)}
+
+	data := make([]byte, 6*swarm.ChunkSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both uploads share their first data chunk
+	first := data[:3*swarm.ChunkSize]
+	second := append(append([]byte(nil), data[:swarm.ChunkSize]...), data[3*swarm.ChunkSize:]...)
+
+	p := builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false, builder.WithAbort())
+	if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(first), int64(len(first))); err != nil {
+		t.Fatal(err)
+	}
+	p = builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false, builder.WithAbort())
+	if _, err := p.Write(second); err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := cac.New(data[:swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := s.count(shared.Address()); c != 2 {
+		t.Fatalf("got reference count %d for the shared chunk, want 2", c)
+	}
+
+	if err := p.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := s.count(shared.Address()); c != 1 {
+		t.Fatalf("got reference count %d for the shared chunk after abort, want 1", c)
+	}
+	for i := 3 * swarm.ChunkSize; i < len(data); i += swarm.ChunkSize {
+		ch, err := cac.New(data[i : i+swarm.ChunkSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := s.count(ch.Address()); c != 0 {
+			t.Fatalf("got reference count %d for an aborted chunk, want 0", c)
+		}
+	}
+}
+
+// countingPutter counts the chunks put to the wrapped storer.
+type countingPutter struct {
+	storage.Storer
+	mu   sync.Mutex
+	puts int
+}
+
+func (p *countingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	p.mu.Lock()
+	p.puts += len(chs)
+	p.mu.Unlock()
+	return p.Storer.Put(ctx, mode, chs...)
+}
+
+func TestSparse(t *testing.T) {
+	ctx := context.Background()
+
+	// 300 data chunks, of which only 10 are not all zero
+	data := make([]byte, 300*swarm.ChunkSize+42)
+	for i := 0; i < 10; i++ {
+		_, err := rand.Read(data[i*30*swarm.ChunkSize : i*30*swarm.ChunkSize+100])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dense := &countingPutter{Storer: mock.NewStorer()}
+	p := builder.NewPipelineBuilder(ctx, dense, storage.ModePutUpload, false)
+	want, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sparse := &countingPutter{Storer: mock.NewStorer()}
+	p = builder.NewPipelineBuilder(ctx, sparse, storage.ModePutUpload, false, builder.WithSparse())
+	got, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got address %s, want %s", got, want)
+	}
+	// 10 non-zero and the last partial data chunks, the zero chunk, 3 intermediate
+	// chunks and the root
+	if sparse.puts != 16 {
+		t.Fatalf("got %d chunks put, want 16 instead of %d", sparse.puts, dense.puts)
+	}
+
+	// the zero chunk is not needed to read the data
+	if err := sparse.Set(ctx, storage.ModeSetRemove, file.ZeroChunkAddress); err != nil {
+		t.Fatal(err)
+	}
+	j, _, err := joiner.New(ctx, sparse, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestTransform(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewStorer()
+
+	data := bytes.Repeat([]byte("hello world "), 3*swarm.ChunkSize/10)
+	p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false)
+	src, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := func(r io.Reader, w io.Writer) error {
+		b := make([]byte, swarm.ChunkSize)
+		for {
+			n, err := r.Read(b)
+			if _, werr := w.Write(bytes.ToUpper(b[:n])); werr != nil {
+				return werr
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	dst, err := builder.Transform(ctx, m, src, storage.ModePutUpload, false, upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, _, err := joiner.New(ctx, m, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.ToUpper(data)) {
+		t.Fatal("data mismatch")
+	}
+
+	errTransform := errors.New("transform")
+	_, err = builder.Transform(ctx, m, src, storage.ModePutUpload, false, func(io.Reader, io.Writer) error {
+		return errTransform
+	})
+	if !errors.Is(err, errTransform) {
+		t.Fatalf("got error %v, want %v", err, errTransform)
+	}
+}
+
+func TestLeafIndex(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 130*swarm.ChunkSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type leaf struct {
+		offset int64
+		addr   swarm.Address
+	}
+	var leaves []leaf
+	index := func(leafIndex int, offset int64, addr swarm.Address) {
+		if leafIndex != len(leaves) {
+			t.Fatalf("got leaf index %d, want %d", leafIndex, len(leaves))
+		}
+		leaves = append(leaves, leaf{offset: offset, addr: addr})
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false, builder.WithLeafIndex(index))
+	// write in odd sized parts, the leaves are reported as they are produced
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := p.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(leaves) != 130 {
+		t.Fatalf("got %d leaves before sum, want 130", len(leaves))
+	}
+	if _, err := p.Sum(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaves) != 131 {
+		t.Fatalf("got %d leaves, want 131", len(leaves))
+	}
+	for i, l := range leaves {
+		if l.offset != int64(i*swarm.ChunkSize) {
+			t.Fatalf("leaf %d: got offset %d, want %d", i, l.offset, i*swarm.ChunkSize)
+		}
+		end := (i + 1) * swarm.ChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		ch, err := cac.New(data[i*swarm.ChunkSize : end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !l.addr.Equal(ch.Address()) {
+			t.Fatalf("leaf %d: got address %s, want %s", i, l.addr, ch.Address())
+		}
+	}
+}
+
+func TestContentID(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 130*swarm.ChunkSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := builder.ContentID(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := builder.ContentID(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Equal(id) {
+		t.Fatalf("got id %s, want %s", again, id)
+	}
+
+	m := mock.NewStorer()
+	p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false)
+	addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.Equal(id) {
+		t.Fatalf("got id %s, want the upload address %s", id, addr)
+	}
+
+	data[0]++
+	other, err := builder.ContentID(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Equal(id) {
+		t.Fatal("different data resulted in the same id")
+	}
+}
+
+// failingPutter fails all the puts of the chunk with the address.
+type failingPutter struct {
+	storage.Storer
+	addr     swarm.Address
+	mu       sync.Mutex
+	attempts int
+}
+
+var errPut = errors.New("put")
+
+func (p *failingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	for _, ch := range chs {
+		if ch.Address().Equal(p.addr) {
+			p.mu.Lock()
+			p.attempts++
+			p.mu.Unlock()
+			return nil, errPut
+		}
+	}
+	return p.Storer.Put(ctx, mode, chs...)
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 10*swarm.ChunkSize+42)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	want, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing, err := cac.New(data[3*swarm.ChunkSize : 4*swarm.ChunkSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &failingPutter{Storer: mock.NewStorer(), addr: failing.Address()}
+
+	p = builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false)
+	if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data))); !errors.Is(err, errPut) {
+		t.Fatalf("got error %v, want %v", err, errPut)
+	}
+
+	var dead []swarm.Chunk
+	s.attempts = 0
+	p = builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false, builder.WithDeadLetter(2, func(ch swarm.Chunk, err error) {
+		if !errors.Is(err, errPut) {
+			t.Errorf("got error %v, want %v", err, errPut)
+		}
+		dead = append(dead, ch)
+	}))
+	got, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Fatalf("got address %s, want %s", got, want)
+	}
+	if s.attempts != 3 {
+		t.Fatalf("got %d put attempts, want 3", s.attempts)
+	}
+	if len(dead) != 1 || !dead[0].Address().Equal(failing.Address()) || !bytes.Equal(dead[0].Data(), failing.Data()) {
+		t.Fatalf("got dead letter chunks %v, want %s", dead, failing.Address())
+	}
+	if has, _ := s.Has(ctx, got); !has {
+		t.Fatal("root chunk not stored")
+	}
+}
+
+// TestDigest tests that the digest of the data is computed along its address.
+func TestDigest(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 10*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt %v", encrypt), func(t *testing.T) {
+			p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, encrypt, builder.WithDigest(swarm.NewHasher()))
+			if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := crypto.LegacyKeccak256(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Digest(); !bytes.Equal(got, want) {
+				t.Fatalf("got digest %x, want %x", got, want)
+			}
+		})
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	if d := p.Digest(); d != nil {
+		t.Fatalf("got digest %x without WithDigest", d)
+	}
+}
+
+// TestProgress tests that the progress is reported at every chunk boundary
+// and once all the chunks are produced.
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	store := &countingPutter{Storer: mock.NewStorer()}
+	data := make([]byte, 10*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	type progress struct{ bytes, chunks int64 }
+	var got []progress
+	p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithProgress(func(bytes, chunks, _ int64) {
+		got = append(got, progress{bytes, chunks})
+	}))
+
+	for b := data; len(b) > 0; {
+		n := 1000
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := p.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if len(got) != 10 {
+		t.Fatalf("got %d reports from writes, want 10", len(got))
+	}
+	for i, r := range got {
+		if r.bytes < int64(i+1)*swarm.ChunkSize || r.bytes >= int64(i+1)*swarm.ChunkSize+1000 {
+			t.Fatalf("report %d: got %d bytes at chunk boundary %d", i, r.bytes, i+1)
+		}
+		if i > 0 && r.chunks < got[i-1].chunks {
+			t.Fatalf("report %d: chunks decreased from %d to %d", i, got[i-1].chunks, r.chunks)
+		}
+	}
+
+	if _, err := p.Sum(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 11 {
+		t.Fatalf("got %d reports, want 11", len(got))
+	}
+	want := progress{int64(len(data)), int64(store.puts)}
+	if last := got[len(got)-1]; last != want {
+		t.Fatalf("got final report %+v, want %+v", last, want)
+	}
+}
+
+// TestChunkSize tests that content written with a custom chunk size is read
+// by a joiner using the same size.
+func TestChunkSize(t *testing.T) {
+	ctx := context.Background()
+	const chunkSize = 2 * swarm.ChunkSize
+	data := make([]byte, 300*chunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	store := mock.NewStorer()
+	p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithChunkSize(chunkSize))
+	addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	defAddr, err := builder.FeedPipeline(ctx, def, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Equal(defAddr) {
+		t.Fatal("got the address of the default chunk size")
+	}
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 301 data chunk references fit into two intermediate chunks of 256
+	if l := len(root.Data()); l != swarm.SpanSize+2*swarm.HashSize {
+		t.Fatalf("got root chunk length %d, want %d", l, swarm.SpanSize+2*swarm.HashSize)
+	}
+
+	j, span, err := joiner.New(ctx, store, addr, joiner.WithChunkSize(chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span != int64(len(data)) {
+		t.Fatalf("got span %d, want %d", span, len(data))
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	for _, tc := range []struct {
+		size    int
+		encrypt bool
+	}{
+		{size: 1000},
+		{size: swarm.SectionSize},
+		{size: chunkSize, encrypt: true},
+	} {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, tc.encrypt, builder.WithChunkSize(tc.size))
+		if _, err := p.Write(data[:10]); !errors.Is(err, builder.ErrChunkSize) {
+			t.Fatalf("size %d: got error %v, want %v", tc.size, err, builder.ErrChunkSize)
+		}
+		if _, err := p.Sum(); !errors.Is(err, builder.ErrChunkSize) {
+			t.Fatalf("size %d: got error %v, want %v", tc.size, err, builder.ErrChunkSize)
+		}
+	}
+	if _, _, err := joiner.New(ctx, store, addr, joiner.WithChunkSize(1000)); !errors.Is(err, joiner.ErrChunkSize) {
+		t.Fatalf("got error %v, want %v", err, joiner.ErrChunkSize)
+	}
+}
+
+// TestChunkOrder tests that the chunks are produced in the order of a
+// depth-first traversal of the trie, with the root last.
+func TestChunkOrder(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		size    int
+		encrypt bool
+	}{
+		{size: 42},
+		{size: swarm.ChunkSize},
+		{size: 128*swarm.ChunkSize + 1},
+		{size: 3*128*swarm.ChunkSize + 5*swarm.ChunkSize + 42},
+		{size: 128 * 128 * swarm.ChunkSize},
+		{size: 64*swarm.ChunkSize + 1, encrypt: true},
+		{size: 64*64*swarm.ChunkSize + 42, encrypt: true},
+	} {
+		t.Run(fmt.Sprintf("%d bytes encrypt %v", tc.size, tc.encrypt), func(t *testing.T) {
+			data := make([]byte, tc.size)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatal(err)
+			}
+
+			var events []builder.ChunkEvent
+			p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, tc.encrypt, builder.WithChunkRecorder(func(e builder.ChunkEvent) {
+				events = append(events, e)
+			}))
+			addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := builder.VerifyChunkOrder(events, int64(tc.size), tc.encrypt); err != nil {
+				t.Fatal(err)
+			}
+			if root := events[len(events)-1].Address; !root.Equal(addr) {
+				t.Fatalf("got last chunk %s, want root %s", root, addr)
+			}
+
+			if len(events) > 1 {
+				events[0], events[len(events)-1] = events[len(events)-1], events[0]
+				if err := builder.VerifyChunkOrder(events, int64(tc.size), tc.encrypt); !errors.Is(err, builder.ErrChunkOrder) {
+					t.Fatalf("got error %v, want %v", err, builder.ErrChunkOrder)
+				}
+			}
+			if err := builder.VerifyChunkOrder(events[1:], int64(tc.size), tc.encrypt); !errors.Is(err, builder.ErrChunkOrder) {
+				t.Fatalf("got error %v, want %v", err, builder.ErrChunkOrder)
+			}
+		})
+	}
+}
+
+// TestEncryptedReference tests that the address returned by an encryption
+// pipeline is the address of the stored root chunk followed by its key.
+func TestEncryptedReference(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 3*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	store := mock.NewStorer()
+	p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, true)
+	ref, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, key, err := encryption.SplitReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, storage.ModeGetRequest, addr); err != nil {
+		t.Fatalf("root chunk %s: %v", addr, err)
+	}
+
+	j, _, err := joiner.New(ctx, store, addr, joiner.WithDecryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	if _, _, err := encryption.SplitReference(addr); !errors.Is(err, encryption.ErrReferenceSize) {
+		t.Fatalf("got error %v, want %v", err, encryption.ErrReferenceSize)
+	}
+}
+
+// TestCheckpoint tests that a pipeline restored from a checkpoint produces the
+// same address and digest as an uninterrupted one.
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 130*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	seed := []byte("seed")
+
+	for _, encrypt := range []bool{false, true} {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, encrypt, builder.WithEncryptionSeed(seed))
+		if _, err := p.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		want, err := p.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, cut := range []int{0, 1, swarm.ChunkSize, 3*swarm.ChunkSize + 17, 128 * swarm.ChunkSize, len(data)} {
+			t.Run(fmt.Sprintf("encrypt %v cut %d", encrypt, cut), func(t *testing.T) {
+				m := mock.NewStorer()
+				var indices []int
+				opts := []builder.Option{
+					builder.WithEncryptionSeed(seed),
+					builder.WithDigest(sha256.New()),
+					builder.WithLeafIndex(func(index int, offset int64, addr swarm.Address) {
+						indices = append(indices, index)
+					}),
+				}
+
+				p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, encrypt, opts...)
+				if _, err := p.Write(data[:cut]); err != nil {
+					t.Fatal(err)
+				}
+				state, err := p.Checkpoint()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				opts[1] = builder.WithDigest(sha256.New())
+				p, err = builder.RestorePipelineBuilder(ctx, m, storage.ModePutUpload, state, opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.ByteCount() != int64(cut) {
+					t.Fatalf("got byte count %d, want %d", p.ByteCount(), cut)
+				}
+				if _, err := p.Write(data[cut:]); err != nil {
+					t.Fatal(err)
+				}
+				got, err := p.Sum()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("got address %x, want %x", got, want)
+				}
+
+				digest := sha256.Sum256(data)
+				if d := p.Digest(); !bytes.Equal(d, digest[:]) {
+					t.Fatalf("got digest %x, want %x", d, digest)
+				}
+				for i, index := range indices {
+					if index != i {
+						t.Fatalf("got leaf index %d, want %d", index, i)
+					}
+				}
+				if len(indices) != 131 {
+					t.Fatalf("got %d leaves, want 131", len(indices))
+				}
+
+				r, _, err := joiner.New(ctx, m, swarm.NewAddress(got))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Fatal("data mismatch")
+				}
+			})
+		}
+	}
+
+	t.Run("version", func(t *testing.T) {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+		state, err := p.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state[0]++
+		if _, err := builder.RestorePipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, state); !errors.Is(err, builder.ErrCheckpointVersion) {
+			t.Fatalf("got error %v, want %v", err, builder.ErrCheckpointVersion)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+		if _, err := p.Write(data[:3*swarm.ChunkSize]); err != nil {
+			t.Fatal(err)
+		}
+		state, err := p.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range [][]byte{nil, state[:len(state)-1], append(state, 0)} {
+			if _, err := builder.RestorePipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, s); !errors.Is(err, builder.ErrCheckpoint) {
+				t.Fatalf("got error %v, want %v", err, builder.ErrCheckpoint)
+			}
+		}
+	})
+}
+
+// TestWriteCancel tests that a write returns once its context is cancelled,
+// without storing the rest of the chunks.
+func TestWriteCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const cancelAfter = 10
+	s := &cancellingPutter{Putter: mock.NewStorer(), after: cancelAfter, cancel: cancel}
+	p := builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false)
+
+	data := make([]byte, 100*swarm.ChunkSize)
+	if _, err := p.Write(data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if s.puts != cancelAfter {
+		t.Fatalf("got %d chunks stored, want %d", s.puts, cancelAfter)
+	}
+}
+
+// cancellingPutter cancels the context after the given number of puts.
+type cancellingPutter struct {
+	storage.Putter
+	after  int
+	puts   int
+	cancel context.CancelFunc
+}
+
+func (c *cancellingPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	c.puts++
+	if c.puts == c.after {
+		c.cancel()
+	}
+	return c.Putter.Put(ctx, mode, chs...)
+}
+
+// TestFeedPipeline tests that the pipeline is fed whole chunks from a reader
+// returning short reads, of data of an unknown length.
+func TestFeedPipeline(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 10*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	want, err := p.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &recordingWriter{Pipeline: builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)}
+	addr, err := builder.FeedPipeline(ctx, w, iotest.HalfReader(bytes.NewReader(data)), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(addr.Bytes(), want) {
+		t.Fatalf("got address %s, want %x", addr, want)
+	}
+	if len(w.writes) != 11 {
+		t.Fatalf("got %d writes, want 11", len(w.writes))
+	}
+	for i, n := range w.writes {
+		want := swarm.ChunkSize
+		if i == len(w.writes)-1 {
+			want = 42
+		}
+		if n != want {
+			t.Fatalf("got write %d of %d bytes, want %d", i, n, want)
+		}
+	}
+
+	if _, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(data), int64(len(data)+1)); err == nil {
+		t.Fatal("expected error for short data")
+	}
+}
+
+// recordingWriter records the sizes of the writes to the pipeline.
+type recordingWriter struct {
+	*builder.Pipeline
+	writes []int
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, len(b))
+	return w.Pipeline.Write(b)
+}
+
+// TestSize tests that a pipeline of a known size stores the intermediate
+// chunks as the data is written, completing the trie with the last write.
+func TestSize(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 130*swarm.ChunkSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	want, err := p.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &intermediatePutter{Putter: mock.NewStorer()}
+	p = builder.NewPipelineBuilder(ctx, s, storage.ModePutUpload, false, builder.WithSize(int64(len(data))))
+	// drip the data in writes smaller than a chunk
+	const drip = 1000
+	for off := 0; off < len(data); off += drip {
+		end := off + drip
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := p.Write(data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+		// the first intermediate chunk is stored with its last data chunk
+		if end > 129*swarm.ChunkSize && end < len(data) && s.count() != 1 {
+			t.Fatalf("got %d intermediate chunks stored at offset %d, want 1", s.count(), end)
+		}
+	}
+	// the rest of the trie is stored by the last write
+	stored := s.count()
+	if stored != 3 {
+		t.Fatalf("got %d intermediate chunks stored, want 3", stored)
+	}
+	got, err := p.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got address %x, want %x", got, want)
+	}
+	if s.count() != stored {
+		t.Fatalf("got %d intermediate chunks stored by sum", s.count()-stored)
+	}
+
+	p = builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false, builder.WithSize(10))
+	if _, err := p.Write(data[:5]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Sum(); !errors.Is(err, builder.ErrSize) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrSize)
+	}
+	if _, err := p.Write(data[:6]); !errors.Is(err, builder.ErrSize) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrSize)
+	}
+}
+
+// intermediatePutter counts the intermediate chunks put.
+type intermediatePutter struct {
+	storage.Putter
+	mu            sync.Mutex
+	intermediates int
+}
+
+func (p *intermediatePutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	p.mu.Lock()
+	for _, ch := range chs {
+		if file.LittleEndianSpan.DecodeSpan(ch.Data()[:swarm.SpanSize]) > swarm.ChunkSize {
+			p.intermediates++
+		}
+	}
+	p.mu.Unlock()
+	return p.Putter.Put(ctx, mode, chs...)
+}
+
+func (p *intermediatePutter) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.intermediates
+}
+
+// TestLeafStats tests that the repeated data chunks are counted.
+func TestLeafStats(t *testing.T) {
+	ctx := context.Background()
+
+	block := func(b byte) []byte {
+		return bytes.Repeat([]byte{b}, swarm.ChunkSize)
+	}
+	// blocks a, b, a, a, zero, zero and a partial chunk
+	var data []byte
+	for _, b := range [][]byte{block(1), block(2), block(1), block(1), block(0), block(0), []byte("tail")} {
+		data = append(data, b...)
+	}
+	want := builder.LeafStats{Unique: 4, Duplicates: 3}
+
+	for _, tc := range []struct {
+		encrypt bool
+		opts    []builder.Option
+	}{
+		{opts: []builder.Option{builder.WithLeafStats()}},
+		{opts: []builder.Option{builder.WithLeafStats(), builder.WithSparse()}},
+		// the repeated chunks are encrypted with different random keys
+		{encrypt: true, opts: []builder.Option{builder.WithLeafStats()}},
+		{encrypt: true, opts: []builder.Option{builder.WithLeafStats(), builder.WithEncryptionSeed([]byte("seed"))}},
+	} {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, tc.encrypt, tc.opts...)
+		if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.LeafStats(); got != want {
+			t.Fatalf("encrypt %v: got leaf stats %+v, want %+v", tc.encrypt, got, want)
+		}
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.LeafStats(); got != (builder.LeafStats{}) {
+		t.Fatalf("got leaf stats %+v without WithLeafStats", got)
+	}
+}
+
+// TestOrderedWriter tests that segments written out of order, concurrently,
+// produce the same root as the data written in order.
+func TestOrderedWriter(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 10*swarm.ChunkSize+1234)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false)
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	want, err := p.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// segments of varying lengths, not aligned to the chunk size
+	var segments [][]byte
+	for rest, l := data, 1; len(rest) > 0; l = l*7%5000 + 1 {
+		if l > len(rest) {
+			l = len(rest)
+		}
+		segments = append(segments, rest[:l])
+		rest = rest[l:]
+	}
+
+	w := builder.NewOrderedWriter(builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false))
+	var wg sync.WaitGroup
+	for seq := len(segments) - 1; seq >= 0; seq-- {
+		wg.Add(1)
+		go func(seq int) {
+			defer wg.Done()
+			if err := w.WriteAt(seq, segments[seq]); err != nil {
+				t.Error(err)
+			}
+		}(seq)
+	}
+	wg.Wait()
+
+	got, err := w.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got root %x, want %x", got, want)
+	}
+
+	w = builder.NewOrderedWriter(builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false))
+	if err := w.WriteAt(1, []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Sum(); !errors.Is(err, builder.ErrSequenceGap) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrSequenceGap)
+	}
+	if err := w.WriteAt(0, []byte("hello ")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteAt(1, []byte("world")); !errors.Is(err, builder.ErrSequence) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrSequence)
+	}
+	got, err = w.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := swarm.MustParseHexAddress("92672a471f4419b255d7cb0cf313474a6f5856fb347c5ece85fb706d644b630f"); !bytes.Equal(got, exp.Bytes()) {
+		t.Fatalf("got root %x, want %s", got, exp)
+	}
+}
+
+// TestRedundancy tests that the pipelines WithRedundancy add the parity chunks
+// to the intermediate chunks, and only to them.
+func TestRedundancy(t *testing.T) {
+	ctx := context.Background()
+	const parities = 4
+
+	size := 130*swarm.ChunkSize + 42
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	store := mock.NewStorer()
+	p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithRedundancy(parities))
+	addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := store.Get(ctx, storage.ModeGetRequest, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := redundancy.Parities(root.Data()[:swarm.SpanSize]); got != parities {
+		t.Fatalf("got %d parities, want %d", got, parities)
+	}
+	if got := redundancy.DecodeSpan(root.Data()[:swarm.SpanSize]); got != int64(size) {
+		t.Fatalf("got span %d, want %d", got, size)
+	}
+	// the data chunks are referenced by two intermediate chunks, of 124 and 7
+	// chunks, which are referenced by the root chunk
+	report, err := joiner.Fsck(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 131 + 2 + 1 + 3*parities; report.Checked != want || !report.Intact() {
+		t.Fatalf("got fsck report %+v, want %d intact chunks", report, want)
+	}
+
+	j, _, err := joiner.New(ctx, store, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+
+	// no parities, the same trie as without the option
+	want, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(data), int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err = builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false, builder.WithRedundancy(0)), bytes.NewReader(data), int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.Equal(want) {
+		t.Fatalf("got address %s without parities, want %s", addr, want)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		encrypt bool
+		opts    []builder.Option
+	}{
+		{name: "encrypted", encrypt: true, opts: []builder.Option{builder.WithRedundancy(parities)}},
+		{name: "too many parities", opts: []builder.Option{builder.WithRedundancy(redundancy.MaxParities + 1)}},
+		{name: "too few data chunks", opts: []builder.Option{builder.WithChunkSize(128), builder.WithRedundancy(3)}},
+		{name: "negative parities", opts: []builder.Option{builder.WithRedundancy(-1)}},
+		{name: "leaf hasher", opts: []builder.Option{builder.WithRedundancy(parities), builder.WithLeafHasher(sha256.New)}},
+	} {
+		p := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, tc.encrypt, tc.opts...)
+		if _, err := p.Write(data[:10]); !errors.Is(err, builder.ErrRedundancy) {
+			t.Fatalf("%s: got error %v, want %v", tc.name, err, builder.ErrRedundancy)
+		}
+	}
+	sharded := builder.NewSharded(ctx, mock.NewStorer(), storage.ModePutUpload, false, 2, builder.WithRedundancy(parities))
+	if _, err := sharded.Shard(0); !errors.Is(err, builder.ErrRedundancy) {
+		t.Fatalf("sharded: got error %v, want %v", err, builder.ErrRedundancy)
+	}
+}
+
+// hasCountingStore counts the calls to HasMulti.
+type hasCountingStore struct {
+	*countingPutter
+	hasMulti int
+}
+
+func (s *hasCountingStore) HasMulti(ctx context.Context, addrs ...swarm.Address) ([]bool, error) {
+	s.mu.Lock()
+	s.hasMulti++
+	s.mu.Unlock()
+	return s.countingPutter.HasMulti(ctx, addrs...)
+}
+
+// putOnlyStore hides the Has methods of the store.
+type putOnlyStore struct {
+	storage.Putter
+}
+
+// TestDedup tests that the chunks already in the store are not put again,
+// and that they are counted in the progress.
+func TestDedup(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 20*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	// a data chunk changed, which changes the root chunk as well
+	changed := append([]byte(nil), data...)
+	changed[5*swarm.ChunkSize] ^= 0xff
+	const chunks = 21 + 1
+
+	store := &hasCountingStore{countingPutter: &countingPutter{Storer: mock.NewStorer()}}
+	if _, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false), bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	want, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(changed), int64(len(changed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		batch        int
+		puts         int
+		deduplicated int64
+		hasMulti     int
+	}{
+		{batch: 8, puts: 2, deduplicated: chunks - 2, hasMulti: 3},
+		// all the chunks are stored by now
+		{batch: 1, puts: 0, deduplicated: chunks},
+		{batch: 100, puts: 0, deduplicated: chunks, hasMulti: 1},
+	} {
+		store.puts, store.hasMulti = 0, 0
+		var deduplicated int64
+		p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithDedup(tc.batch), builder.WithProgress(func(_, _, d int64) {
+			deduplicated = d
+		}))
+		addr, err := builder.FeedPipeline(ctx, p, bytes.NewReader(changed), int64(len(changed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !addr.Equal(want) {
+			t.Fatalf("batch %d: got address %s, want %s", tc.batch, addr, want)
+		}
+		if store.puts != tc.puts {
+			t.Fatalf("batch %d: got %d chunks put, want %d", tc.batch, store.puts, tc.puts)
+		}
+		if deduplicated != tc.deduplicated {
+			t.Fatalf("batch %d: got %d deduplicated chunks, want %d", tc.batch, deduplicated, tc.deduplicated)
+		}
+		if store.hasMulti != tc.hasMulti {
+			t.Fatalf("batch %d: got %d batches checked, want %d", tc.batch, store.hasMulti, tc.hasMulti)
+		}
+	}
+
+	j, _, err := joiner.New(ctx, store, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, changed) {
+		t.Fatal("data mismatch")
+	}
+
+	// the option has no effect for stores without Has
+	putter := &countingPutter{Storer: mock.NewStorer()}
+	var deduplicated int64 = -1
+	p := builder.NewPipelineBuilder(ctx, putOnlyStore{putter}, storage.ModePutUpload, false, builder.WithDedup(8), builder.WithProgress(func(_, _, d int64) {
+		deduplicated = d
+	}))
+	if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(changed), int64(len(changed))); err != nil {
+		t.Fatal(err)
+	}
+	if putter.puts != chunks || deduplicated != 0 {
+		t.Fatalf("got %d chunks put and %d deduplicated without Has, want %d and 0", putter.puts, deduplicated, chunks)
+	}
+}
+
+// TestPartialSum tests that the partial sums of a pipeline are the addresses
+// of the data up to the last complete data chunk written, readable while the
+// data is still written, and that they do not change the final address.
+func TestPartialSum(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 130*swarm.ChunkSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	want, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt=%v", encrypt), func(t *testing.T) {
+			store := mock.NewStorer()
+			p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, encrypt)
+			if _, err := p.Write(data[:swarm.ChunkSize-1]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.PartialSum(); !errors.Is(err, builder.ErrNoPartialSum) {
+				t.Fatalf("got error %v, want %v", err, builder.ErrNoPartialSum)
+			}
+
+			written := swarm.ChunkSize - 1
+			for _, n := range []int{1, 5000, 128*swarm.ChunkSize - 5000, 1, len(data) - 129*swarm.ChunkSize - 1} {
+				if _, err := p.Write(data[written : written+n]); err != nil {
+					t.Fatal(err)
+				}
+				written += n
+
+				sum, err := p.PartialSum()
+				if err != nil {
+					t.Fatal(err)
+				}
+				prefix := data[:written-written%swarm.ChunkSize]
+				if !encrypt {
+					want, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(prefix), int64(len(prefix)))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(sum, want.Bytes()) {
+						t.Fatalf("%d bytes written: got partial sum %x, want %s", written, sum, want)
+					}
+				}
+
+				j, span, err := joiner.New(ctx, store, swarm.NewAddress(sum))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadAll(j)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if span != int64(len(prefix)) || !bytes.Equal(got, prefix) {
+					t.Fatalf("%d bytes written: got %d bytes of data, want %d", written, len(got), len(prefix))
+				}
+			}
+
+			sum, err := p.Sum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !encrypt && !bytes.Equal(sum, want.Bytes()) {
+				t.Fatalf("got address %x, want %s", sum, want)
+			}
+			j, _, err := joiner.New(ctx, store, swarm.NewAddress(sum))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("data mismatch")
+			}
+		})
+	}
+}
+
+// TestReset tests that a pipeline reused after Reset produces the same
+// results as a new one, whether the previous data was complete or not.
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewStorer()
+	p := builder.NewPipelineBuilder(ctx, m, storage.ModePutUpload, false, builder.WithDigest(sha256.New()), builder.WithLeafStats())
+
+	for i := 1; i <= 20; i++ {
+		data, expect := test.GetVector(t, i)
+
+		// abandon half of the data of the previous vector
+		if _, err := p.Write(data[:len(data)/2]); err != nil {
+			t.Fatal(err)
+		}
+		p.Reset(ctx, storage.ModePutUpload)
+
+		if _, err := p.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := p.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sum, expect.Bytes()) {
+			t.Fatalf("vector %d: got address %x, want %s", i, sum, expect)
+		}
+		if p.ByteCount() != int64(len(data)) {
+			t.Fatalf("vector %d: got %d bytes written, want %d", i, p.ByteCount(), len(data))
+		}
+		digest := sha256.Sum256(data)
+		if !bytes.Equal(p.Digest(), digest[:]) {
+			t.Fatalf("vector %d: digest mismatch", i)
+		}
+
+		fresh := builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false, builder.WithLeafStats())
+		if _, err := fresh.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fresh.Sum(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.LeafStats(), fresh.LeafStats(); got != want {
+			t.Fatalf("vector %d: got leaf stats %+v, want %+v", i, got, want)
+		}
+		p.Reset(ctx, storage.ModePutUpload)
+	}
+}
+
+// TestChunkTap tests that the chunk tap reports all the chunks of the trie,
+// stored, in the order of the chunk recorder, the root last.
+func TestChunkTap(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 130*swarm.ChunkSize+42)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		encrypt  bool
+		metadata []byte
+	}{
+		{name: "plain"},
+		{name: "encrypted", encrypt: true},
+		{name: "metadata", metadata: []byte("metadata")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			type tap struct {
+				addr  swarm.Address
+				level int
+			}
+			var (
+				taps   []tap
+				events []builder.ChunkEvent
+			)
+			store := mock.NewStorer()
+			p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, tc.encrypt, builder.WithMetadata(tc.metadata), builder.WithChunkTap(func(addr swarm.Address, level int) {
+				taps = append(taps, tap{addr, level})
+			}), builder.WithChunkRecorder(func(e builder.ChunkEvent) {
+				events = append(events, e)
+			}))
+			root, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the chunks of the metadata and of the wrapper follow
+			want := len(events)
+			if tc.metadata != nil {
+				want += 2
+			}
+			if len(taps) != want {
+				t.Fatalf("got %d chunks tapped, want %d", len(taps), want)
+			}
+			for i, e := range events {
+				if !taps[i].addr.Equal(e.Address) || taps[i].level != e.Level {
+					t.Fatalf("chunk %d: got %s at level %d, want %s at level %d", i, taps[i].addr, taps[i].level, e.Address, e.Level)
+				}
+			}
+			if last := taps[len(taps)-1].addr; !last.Equal(root) {
+				t.Fatalf("got last chunk %s, want root %s", last, root)
+			}
+			for _, tap := range taps {
+				addr := tap.addr
+				if tc.encrypt {
+					addr = swarm.NewAddress(addr.Bytes()[:swarm.HashSize])
+				}
+				if has, err := store.Has(ctx, addr); err != nil || !has {
+					t.Fatalf("chunk %s not stored: %v", addr, err)
+				}
+			}
+		})
+	}
+}
+
+// TestPinOnSuccess tests that all the chunks of a successful upload are
+// pinned once, and that nothing is pinned if the upload fails.
+func TestPinOnSuccess(t *testing.T) {
+	ctx := context.Background()
+
+	// the first data chunk is repeated
+	data := make([]byte, 4*swarm.ChunkSize+42)
+	if _, err := rand.Read(data[:swarm.ChunkSize]); err != nil {
+		t.Fatal(err)
+	}
+	copy(data[swarm.ChunkSize:], data[:swarm.ChunkSize])
+	if _, err := rand.Read(data[2*swarm.ChunkSize:]); err != nil {
+		t.Fatal(err)
+	}
+
+	store := mock.NewStorer()
+	// the deduplicated chunks are pinned as well
+	if _, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false), bytes.NewReader(data[:swarm.ChunkSize]), swarm.ChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	var chunks swarm.AddressSet
+	p := builder.NewPipelineBuilder(ctx, store, storage.ModePutUpload, false, builder.WithPinOnSuccess(), builder.WithDedup(1), builder.WithMetadata([]byte("metadata")), builder.WithChunkTap(func(addr swarm.Address, _ int) {
+		chunks.Add(addr)
+	}))
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, _ := store.PinnedChunks(ctx, 0, 0); len(pinned) != 0 {
+		t.Fatalf("got %d chunks pinned before Sum, want none", len(pinned))
+	}
+	if _, err := p.Sum(); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned, err := store.PinnedChunks(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 distinct data chunks, the root, the metadata and the wrapper
+	if len(pinned) != 7 {
+		t.Fatalf("got %d chunks pinned, want %d", len(pinned), 7)
+	}
+	for _, pin := range pinned {
+		if !chunks.Has(pin.Address) {
+			t.Fatalf("pinned chunk %s not produced by the pipeline", pin.Address)
+		}
+		if pin.PinCounter != 1 {
+			t.Fatalf("chunk %s pinned %d times, want once", pin.Address, pin.PinCounter)
+		}
+	}
+
+	// the root chunk is not stored
+	root, err := builder.FeedPipeline(ctx, builder.NewPipelineBuilder(ctx, mock.NewStorer(), storage.ModePutUpload, false), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &failingPutter{Storer: mock.NewStorer(), addr: root}
+	p = builder.NewPipelineBuilder(ctx, failing, storage.ModePutUpload, false, builder.WithPinOnSuccess())
+	if _, err := builder.FeedPipeline(ctx, p, bytes.NewReader(data), int64(len(data))); !errors.Is(err, errPut) {
+		t.Fatalf("got error %v, want %v", err, errPut)
+	}
+	if pinned, _ := failing.Storer.(*mock.MockStorer).PinnedChunks(ctx, 0, 0); len(pinned) != 0 {
+		t.Fatalf("got %d chunks pinned after a failed upload, want none", len(pinned))
+	}
+
+	p = builder.NewPipelineBuilder(ctx, putOnlyStore{mock.NewStorer()}, storage.ModePutUpload, false, builder.WithPinOnSuccess())
+	if _, err := p.Write(data); !errors.Is(err, builder.ErrNotPinnable) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrNotPinnable)
+	}
+}
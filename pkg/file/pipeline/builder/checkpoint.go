@@ -0,0 +1,194 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethersphere/bee/pkg/storage"
+)
+
+// checkpointVersion is the version of the format of the checkpoint state.
+const checkpointVersion = 1
+
+var (
+	// ErrNotCheckpointable is returned by Checkpoint when the state of the
+	// digest set WithDigest cannot be serialized, and by Checkpoint and
+	// RestorePipelineBuilder for the pipelines WithRedundancy or
+	// WithPinOnSuccess.
+	ErrNotCheckpointable = errors.New("pipeline: not checkpointable")
+	// ErrCheckpoint is returned by RestorePipelineBuilder for an invalid
+	// checkpoint state.
+	ErrCheckpoint = errors.New("pipeline: invalid checkpoint")
+	// ErrCheckpointVersion is returned by RestorePipelineBuilder for a
+	// checkpoint state of an unsupported version.
+	ErrCheckpointVersion = errors.New("pipeline: unsupported checkpoint version")
+)
+
+// Checkpoint returns the serialized state of the pipeline, made of the data
+// written so far that is not yet stored in chunks and the references of the
+// trie levels that are not yet wrapped, from which the upload can be resumed
+// with RestorePipelineBuilder. It must not be called concurrently with Write.
+// The state does not contain secrets other than the keys of the encrypted
+// chunks already referenced in the trie.
+func (p *Pipeline) Checkpoint() ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	// the chunks to pin before the checkpoint are not in the state
+	if p.parities > 0 || p.pinner != nil {
+		return nil, ErrNotCheckpointable
+	}
+	// the chunks stored before the checkpoint are not in the state
+	if err := p.flush(); err != nil {
+		return nil, err
+	}
+
+	var digest []byte
+	if p.digest != nil {
+		m, ok := p.digest.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, ErrNotCheckpointable
+		}
+		var err error
+		if digest, err = m.MarshalBinary(); err != nil {
+			return nil, fmt.Errorf("digest: %w", err)
+		}
+	}
+	buffered, err := p.Interface.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	trie, err := p.trie.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks int64
+	if p.chunks != nil {
+		chunks = atomic.LoadInt64(&p.chunks.count)
+	}
+
+	var flags byte
+	if p.encrypt {
+		flags = 1
+	}
+
+	b := []byte{checkpointVersion, flags}
+	b = appendUvarint(b, uint64(p.chunkSize))
+	b = appendUvarint(b, uint64(atomic.LoadInt64(&p.bytes)))
+	b = appendUvarint(b, uint64(chunks))
+	for _, s := range [][]byte{buffered, trie, digest} {
+		b = appendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	return b, nil
+}
+
+// RestorePipelineBuilder returns a pipeline resuming the upload from the state
+// returned by Checkpoint. Writing the rest of the data to it produces the same
+// address as writing the whole data to the pipeline of the checkpoint. The
+// options must be the ones of the pipeline of the checkpoint, except for the
+// chunk size which is restored from the state, and the state of a digest set
+// WithDigest is restored into it. Chunks stored before the checkpoint are not
+// removed by Abort.
+func RestorePipelineBuilder(ctx context.Context, s storage.Putter, mode storage.ModePut, state []byte, opts ...Option) (*Pipeline, error) {
+	if len(state) < 2 {
+		return nil, ErrCheckpoint
+	}
+	if state[0] != checkpointVersion {
+		return nil, fmt.Errorf("%w: %d", ErrCheckpointVersion, state[0])
+	}
+	if state[1] > 1 {
+		return nil, ErrCheckpoint
+	}
+	encrypt := state[1] == 1
+
+	r := &stateReader{b: state[2:]}
+	chunkSize := r.uvarint()
+	bytes := r.uvarint()
+	chunks := r.uvarint()
+	buffered := r.bytes()
+	trie := r.bytes()
+	digest := r.bytes()
+	if r.err != nil || len(r.b) > 0 || chunkSize == 0 || chunkSize > 1<<30 || uint64(len(buffered)) > bytes {
+		return nil, ErrCheckpoint
+	}
+
+	o := newOptions(append(opts[:len(opts):len(opts)], WithChunkSize(int(chunkSize))))
+	o.firstLeaf = int((bytes - uint64(len(buffered))) / chunkSize)
+	p := newPipelineBuilder(ctx, s, mode, encrypt, o)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.parities > 0 || p.pinner != nil {
+		return nil, ErrNotCheckpointable
+	}
+
+	if err := p.Interface.(encoding.BinaryUnmarshaler).UnmarshalBinary(buffered); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCheckpoint, err)
+	}
+	if err := p.trie.(encoding.BinaryUnmarshaler).UnmarshalBinary(trie); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCheckpoint, err)
+	}
+	if p.digest != nil {
+		u, ok := p.digest.(encoding.BinaryUnmarshaler)
+		if !ok || len(digest) == 0 {
+			return nil, fmt.Errorf("%w: no digest state", ErrCheckpoint)
+		}
+		if err := u.UnmarshalBinary(digest); err != nil {
+			return nil, fmt.Errorf("%w: digest: %v", ErrCheckpoint, err)
+		}
+	}
+	p.bytes = int64(bytes)
+	if p.chunks != nil {
+		p.chunks.count = int64(chunks)
+	}
+	return p, nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// stateReader decodes the fields of a checkpoint state, keeping the first
+// error encountered.
+type stateReader struct {
+	b   []byte
+	err error
+}
+
+func (r *stateReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = ErrCheckpoint
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *stateReader) bytes() []byte {
+	l := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if l > uint64(len(r.b)) {
+		r.err = ErrCheckpoint
+		return nil
+	}
+	b := r.b[:l]
+	r.b = r.b[l:]
+	return b
+}
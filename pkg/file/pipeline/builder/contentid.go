@@ -0,0 +1,35 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"io"
+
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ContentID returns the address of the unencrypted data read from r until
+// EOF, without storing any chunks. The same data always results in the same
+// id, which is the address the data would be uploaded to.
+func ContentID(ctx context.Context, r io.Reader) (swarm.Address, error) {
+	p := NewPipelineBuilder(ctx, discardPutter{}, storage.ModePutUpload, false)
+	if _, err := io.Copy(p, r); err != nil {
+		return swarm.ZeroAddress, err
+	}
+	sum, err := p.Sum()
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	return swarm.NewAddress(sum), nil
+}
+
+// discardPutter is a putter that does not store the chunks put to it.
+type discardPutter struct{}
+
+func (discardPutter) Put(_ context.Context, _ storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	return make([]bool, len(chs)), nil
+}
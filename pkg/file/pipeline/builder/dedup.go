@@ -0,0 +1,127 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// WithDedup makes the pipeline check whether the chunks it produces are
+// already in the store, if the store is a storage.Hasser, and put only the
+// ones that are not. The chunks are checked with HasMulti in batches of the
+// size, and put once their batch is full or by Sum, or checked one by one with
+// Has for a batch size of one or less. The puts of the batched chunks report
+// the chunks as not existing, which is what the tags count them as. The
+// number of chunks that are not put is passed to the ProgressFunc. Stores
+// where Has is expensive are better written to without the option. It has no
+// effect on sharded pipelines.
+func WithDedup(batch int) Option {
+	return optionFunc(func(o *options) {
+		o.dedup = true
+		o.dedupBatch = batch
+	})
+}
+
+// dedupPutter puts only the chunks that are not in the store.
+type dedupPutter struct {
+	storage.Putter
+	hasser storage.Hasser
+	batch  int
+	count  int64 // number of chunks not put, accessed atomically
+
+	mu      sync.Mutex
+	pending []swarm.Chunk
+	ctx     context.Context // of the puts of the pending chunks
+	mode    storage.ModePut
+}
+
+func (d *dedupPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	if d.batch <= 1 {
+		exist := make([]bool, len(chs))
+		var put []swarm.Chunk
+		for i, ch := range chs {
+			has, err := d.hasser.Has(ctx, ch.Address())
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				exist[i] = true
+				atomic.AddInt64(&d.count, 1)
+				continue
+			}
+			put = append(put, ch)
+		}
+		if len(put) > 0 {
+			if _, err := d.Putter.Put(ctx, mode, put...); err != nil {
+				return nil, err
+			}
+		}
+		return exist, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = append(d.pending, chs...)
+	d.ctx, d.mode = ctx, mode
+	if len(d.pending) >= d.batch {
+		if err := d.flushLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return make([]bool, len(chs)), nil
+}
+
+// flush puts the pending chunks that are not in the store.
+func (d *dedupPutter) flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flushLocked()
+}
+
+func (d *dedupPutter) flushLocked() error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	chs := d.pending
+	d.pending = nil
+
+	addrs := make([]swarm.Address, len(chs))
+	for i, ch := range chs {
+		addrs[i] = ch.Address()
+	}
+	has, err := d.hasser.HasMulti(d.ctx, addrs...)
+	if err != nil {
+		return err
+	}
+
+	var put []swarm.Chunk
+	seen := make(map[string]struct{}, len(chs))
+	for i, ch := range chs {
+		// the repeated chunks of a batch are not in the store yet
+		key := ch.Address().ByteString()
+		if _, ok := seen[key]; ok || has[i] {
+			atomic.AddInt64(&d.count, 1)
+			continue
+		}
+		seen[key] = struct{}{}
+		put = append(put, ch)
+	}
+	if len(put) == 0 {
+		return nil
+	}
+	_, err = d.Putter.Put(d.ctx, d.mode, put...)
+	return err
+}
+
+// deduplicated returns the number of chunks not put because they were in
+// the store.
+func (d *dedupPutter) deduplicated() int64 {
+	return atomic.LoadInt64(&d.count)
+}
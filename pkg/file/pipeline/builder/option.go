@@ -0,0 +1,246 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"hash"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// Option is an optional parameter of the pipeline built by NewPipelineBuilder.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) { f(o) }
+
+type options struct {
+	abort      bool
+	chunkSize  int
+	spanCodec  file.SpanCodec
+	leafHasher func() hash.Hash
+	leafHook   LeafHook
+
+	encryptionSeed []byte
+	sparse         bool
+	leafIndex      LeafIndexFunc
+	firstLeaf      int // index of the first data chunk, for restored pipelines
+	metadata       []byte
+	digest         hash.Hash
+	progress       ProgressFunc
+	chunkRecorder  func(ChunkEvent)
+	chunkTap       ChunkTapFunc
+	leafStats      *leafStatsWriter
+	size           int64 // known size of the data, if sized
+	sized          bool
+	parities       int
+	dedup          bool
+	dedupBatch     int
+	pin            bool
+
+	putRetries int
+	deadLetter DeadLetterFunc
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		chunkSize: swarm.ChunkSize,
+		spanCodec: file.LittleEndianSpan,
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// WithAbort makes the pipeline keep track of the chunks it stores, so that
+// they can be removed with Abort if the upload is abandoned.
+func WithAbort() Option {
+	return optionFunc(func(o *options) {
+		o.abort = true
+	})
+}
+
+// WithChunkSize sets the maximum length of the data of the chunks, which must
+// be a power of two multiple of swarm.SectionSize, of at least two sections.
+// Chunks of a size other than swarm.ChunkSize are not valid content addressed
+// chunks of the network, and the content can only be read by a joiner using
+// the same size. Other sizes are not supported for encrypted content, and
+// make the pipeline return ErrChunkSize.
+func WithChunkSize(size int) Option {
+	return optionFunc(func(o *options) {
+		o.chunkSize = size
+	})
+}
+
+// WithRedundancy makes the pipeline add parities parity chunks to every
+// intermediate chunk of the trie, from which the chunks the intermediate chunk
+// references can be reconstructed by a joiner WithRecovery, as long as no more
+// than parities of its chunks are lost. Every intermediate chunk references
+// parities fewer chunks of data, so the trie and its root address differ from
+// the ones of a pipeline without parities. The parities must be at most
+// redundancy.MaxParities, and leave at least two chunks of data in every
+// intermediate chunk. Redundancy is not supported for encrypted content,
+// custom span codecs and leaf hashers, and makes sharded pipelines, as well as
+// any other pipeline it is not supported for, return ErrRedundancy.
+func WithRedundancy(parities int) Option {
+	return optionFunc(func(o *options) {
+		o.parities = parities
+	})
+}
+
+// validRedundancy returns true if the redundancy set with WithRedundancy is
+// supported by the pipeline.
+func (o *options) validRedundancy(encrypt bool) bool {
+	if o.parities == 0 {
+		return true
+	}
+	return !encrypt && o.parities > 0 && o.parities <= redundancy.MaxParities && o.chunkSize/swarm.HashSize-o.parities >= 2 &&
+		o.spanCodec == file.LittleEndianSpan && o.leafHasher == nil
+}
+
+// validChunkSize returns true if the chunk size is supported by the pipeline.
+func (o *options) validChunkSize(encrypt bool) bool {
+	if encrypt {
+		return o.chunkSize == swarm.ChunkSize
+	}
+	return o.chunkSize >= 2*swarm.SectionSize && o.chunkSize%swarm.SectionSize == 0 && o.chunkSize&(o.chunkSize-1) == 0
+}
+
+// WithSpanCodec sets the codec used to serialize chunk spans. Custom codecs
+// change the resulting addresses, so the content can only be read by a
+// joiner using the same codec. Custom codecs are not supported by the
+// decryption of encrypted content.
+func WithSpanCodec(c file.SpanCodec) Option {
+	return optionFunc(func(o *options) {
+		o.spanCodec = c
+	})
+}
+
+// WithLeafHasher replaces the BMT hash of the data chunks with the digest of
+// the hashers returned by hasherFn, while intermediate chunks are still BMT
+// hashed. The resulting addresses are not valid content addressed chunk
+// addresses, so this option is meant for research purposes only.
+func WithLeafHasher(hasherFn func() hash.Hash) Option {
+	return optionFunc(func(o *options) {
+		o.leafHasher = hasherFn
+	})
+}
+
+// LeafHook is called with the address and the chunk data, including the span,
+// of every data chunk produced by the pipeline. If it returns true the chunk
+// is not stored, while it is still referenced by the resulting trie.
+type LeafHook func(addr swarm.Address, data []byte) (skipStore bool, err error)
+
+// WithLeafHook sets the hook deciding whether each data chunk is stored,
+// for uploaders that skip the chunks already present elsewhere. The hook
+// does not change the resulting address.
+func WithLeafHook(hook LeafHook) Option {
+	return optionFunc(func(o *options) {
+		o.leafHook = hook
+	})
+}
+
+// WithEncryptionSeed makes the encryption pipeline derive the key of every
+// chunk from the seed and the chunk data instead of generating it randomly,
+// so that encrypting the same data with the same seed always results in the
+// same reference. The seed must be kept secret as it allows the derivation
+// of the keys of any known data.
+func WithEncryptionSeed(seed []byte) Option {
+	return optionFunc(func(o *options) {
+		o.encryptionSeed = seed
+	})
+}
+
+// WithSparse makes the pipeline recognize the data chunks consisting only of
+// zero bytes, which are referenced by file.ZeroChunkAddress, storing the zero
+// chunk only once without hashing them. It does not change the resulting
+// address. It has no effect on encrypted pipelines and together with custom
+// span codecs or leaf hashers.
+func WithSparse() Option {
+	return optionFunc(func(o *options) {
+		o.sparse = true
+	})
+}
+
+// LeafIndexFunc is called with the index, the offset of the data and the
+// reference of every data chunk produced by the pipeline, in order.
+type LeafIndexFunc func(leafIndex int, offset int64, addr swarm.Address)
+
+// WithLeafIndex sets the function reporting the data chunks as they are
+// produced, for building an index of the offsets of the data without
+// traversing the resulting trie. It has no effect on sharded pipelines.
+func WithLeafIndex(fn LeafIndexFunc) Option {
+	return optionFunc(func(o *options) {
+		o.leafIndex = fn
+	})
+}
+
+// WithMetadata attaches the metadata to the data written to the pipeline.
+// The metadata is stored separately from the data, and Sum returns the
+// address of a wrapper holding file.MetadataWrapperPrefix followed by the
+// concatenated references of the data and of the metadata, which can be read
+// with joiner.ReadMetadata.
+func WithMetadata(metadata []byte) Option {
+	return optionFunc(func(o *options) {
+		o.metadata = metadata
+	})
+}
+
+// DeadLetterFunc is called with the chunks that could not be stored, and the
+// error of the last attempt.
+type DeadLetterFunc func(ch swarm.Chunk, err error)
+
+// WithDeadLetter makes the pipeline retry failing puts of chunks up to
+// retries times, after which the chunks are passed to the sink and the
+// pipeline continues, producing the address of the data regardless of the
+// chunks missing from the store.
+func WithDeadLetter(retries int, sink DeadLetterFunc) Option {
+	return optionFunc(func(o *options) {
+		o.putRetries = retries
+		o.deadLetter = sink
+	})
+}
+
+// WithDigest makes the pipeline hash the data written to it with h, in the
+// same pass as the chunks are hashed, providing the digest of the whole data
+// through Digest.
+func WithDigest(h hash.Hash) Option {
+	return optionFunc(func(o *options) {
+		o.digest = h
+	})
+}
+
+// ProgressFunc is called with the number of bytes written to the pipeline, the
+// number of chunks it produced so far, and the number of them that were not
+// put because they were already in the store, which is zero unless the
+// pipeline is built WithDedup.
+type ProgressFunc func(bytesWritten, chunksWritten, chunksDeduplicated int64)
+
+// WithProgress makes the pipeline report its progress to fn, from Write every
+// time the data written crosses a chunk boundary, and from Sum once all the
+// chunks are produced.
+func WithProgress(fn ProgressFunc) Option {
+	return optionFunc(func(o *options) {
+		o.progress = fn
+	})
+}
+
+// WithSize sets the size of the data to be written to the pipeline, known up
+// front. The pipeline then completes the trie, storing the last chunks, as
+// soon as the last byte of the data is written, instead of waiting for Sum.
+// Writes beyond the size, and Sum before the whole data is written, return
+// ErrSize. It has no effect on sharded pipelines.
+func WithSize(size int64) Option {
+	return optionFunc(func(o *options) {
+		o.size = size
+		o.sized = true
+	})
+}
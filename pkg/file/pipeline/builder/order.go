@@ -0,0 +1,177 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/encryption"
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ErrChunkOrder is returned by VerifyChunkOrder when the chunks were not
+// produced in the expected order.
+var ErrChunkOrder = errors.New("pipeline: unexpected chunk order")
+
+// ChunkEvent describes a chunk produced by the pipeline.
+type ChunkEvent struct {
+	// Level is the height of the chunk in the trie, 0 for data chunks.
+	Level int
+	// Span is the length of the data covered by the chunk.
+	Span    int64
+	Address swarm.Address
+}
+
+// WithChunkRecorder makes the pipeline report every chunk of the trie of the
+// data to fn, in the order the chunks are produced, for tests asserting the
+// order with VerifyChunkOrder. The chunks of the metadata are not reported.
+// It has no effect on sharded pipelines.
+func WithChunkRecorder(fn func(ChunkEvent)) Option {
+	return optionFunc(func(o *options) {
+		o.chunkRecorder = fn
+	})
+}
+
+// ChunkTapFunc is called with the address and the level of every chunk of the
+// trie produced by the pipeline, in order.
+type ChunkTapFunc func(addr swarm.Address, level int)
+
+// WithChunkTap makes the pipeline report every chunk it produces to fn, once
+// the chunk is hashed and passed to the putter, for building indexes of the
+// chunks of the data, like pin sets, without traversing the resulting trie.
+// The chunks are reported in the order of WithChunkRecorder, the root chunk
+// last, with their levels in the trie, 0 for data chunks, and the complete
+// encrypted references for encryption pipelines. The chunks repeated in the
+// data are reported every time they occur. The chunks of the metadata
+// attached WithMetadata and of its wrapper follow, the wrapper last, with
+// their levels in their own tries. The parity chunks of WithRedundancy and
+// the chunks of PartialSum are not reported. It has no effect on sharded
+// pipelines.
+func WithChunkTap(fn ChunkTapFunc) Option {
+	return optionFunc(func(o *options) {
+		o.chunkTap = fn
+	})
+}
+
+// VerifyChunkOrder checks that the events recorded WithChunkRecorder for data
+// of the size, written with the default chunk size, are the chunks of its
+// trie in the order of a depth-first traversal where every intermediate chunk
+// follows the chunks it references. The addresses of the events are not
+// checked.
+func VerifyChunkOrder(events []ChunkEvent, size int64, encrypt bool) error {
+	refLength := swarm.HashSize
+	if encrypt {
+		refLength = encryption.ReferenceSize
+	}
+	branching := int64(swarm.ChunkSize / refLength)
+
+	var want []ChunkEvent
+	var walk func(span int64)
+	walk = func(span int64) {
+		if span <= swarm.ChunkSize {
+			want = append(want, ChunkEvent{Span: span})
+			return
+		}
+		// the capacity of the subtries of the chunk
+		sub := int64(swarm.ChunkSize)
+		for sub*branching < span {
+			sub *= branching
+		}
+		for off := int64(0); off < span; off += sub {
+			if l := span - off; l < sub {
+				walk(l)
+			} else {
+				walk(sub)
+			}
+		}
+		want = append(want, ChunkEvent{Level: chunkLevel(span, swarm.ChunkSize, branching), Span: span})
+	}
+	walk(size)
+
+	for i, e := range events {
+		if i >= len(want) {
+			return fmt.Errorf("%w: %d chunks, want %d", ErrChunkOrder, len(events), len(want))
+		}
+		if e.Level != want[i].Level || e.Span != want[i].Span {
+			return fmt.Errorf("%w: chunk %d at level %d with span %d, want level %d with span %d", ErrChunkOrder, i, e.Level, e.Span, want[i].Level, want[i].Span)
+		}
+	}
+	if len(events) != len(want) {
+		return fmt.Errorf("%w: %d chunks, want %d", ErrChunkOrder, len(events), len(want))
+	}
+	return nil
+}
+
+// chunkLevel returns the height of a chunk covering span bytes of data in a
+// trie with the chunk size and branching.
+func chunkLevel(span, chunkSize, branching int64) int {
+	level := 0
+	for size := chunkSize; size < span; size *= branching {
+		level++
+	}
+	return level
+}
+
+// withChunkRecorder returns a writer reporting the chunks written to next,
+// if a chunk recorder or a chunk tap is set. The data chunks are reported before they are
+// passed to next, which references them in the trie, while the intermediate
+// chunks are reported once next has hashed them.
+func withChunkRecorder(o *options, refLength int, leaf bool, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.chunkRecorder == nil && o.chunkTap == nil {
+		return next
+	}
+	return &chunkRecorderWriter{
+		o:         o,
+		branching: int64(o.chunkSize/refLength - o.parities),
+		leaf:      leaf,
+		next:      next,
+	}
+}
+
+type chunkRecorderWriter struct {
+	o         *options
+	branching int64
+	leaf      bool
+	next      pipeline.ChainWriter
+}
+
+func (w *chunkRecorderWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	if w.leaf {
+		w.record(p)
+		return w.next.ChainWrite(p)
+	}
+	if err := w.next.ChainWrite(p); err != nil {
+		return err
+	}
+	w.record(p)
+	return nil
+}
+
+func (w *chunkRecorderWriter) record(p *pipeline.PipeWriteArgs) {
+	span := int64(w.o.spanCodec.DecodeSpan(p.Span))
+	if w.o.parities > 0 {
+		span = redundancy.DecodeSpan(p.Span)
+	}
+	ref := make([]byte, 0, len(p.Ref)+len(p.Key))
+	ref = append(append(ref, p.Ref...), p.Key...)
+
+	e := ChunkEvent{Span: span, Address: swarm.NewAddress(ref)}
+	if !w.leaf {
+		e.Level = chunkLevel(span, int64(w.o.chunkSize), w.branching)
+	}
+	if w.o.chunkRecorder != nil {
+		w.o.chunkRecorder(e)
+	}
+	if w.o.chunkTap != nil {
+		w.o.chunkTap(e.Address, e.Level)
+	}
+}
+
+func (w *chunkRecorderWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+)
+
+var (
+	// ErrSequence is returned by WriteAt for a sequence number that was
+	// already written.
+	ErrSequence = errors.New("pipeline: sequence number already written")
+	// ErrSequenceGap is returned by Sum when some of the segments preceding
+	// the ones written are missing.
+	ErrSequenceGap = errors.New("pipeline: missing segments")
+)
+
+// OrderedWriter writes segments of data tagged with sequence numbers to a
+// pipeline in the order of the numbers, whatever the order they are written
+// in, so that a pipeline can be fed by many goroutines.
+type OrderedWriter struct {
+	p pipeline.Interface
+
+	mu      sync.Mutex
+	next    int            // sequence number of the next segment to write to the pipeline
+	pending map[int][]byte // segments not written to the pipeline yet
+	err     error          // of the pipeline, returned by all the writes
+}
+
+// NewOrderedWriter returns an OrderedWriter of the pipeline. The sequence
+// numbers of the segments start at zero.
+func NewOrderedWriter(p pipeline.Interface) *OrderedWriter {
+	return &OrderedWriter{
+		p:       p,
+		pending: make(map[int][]byte),
+	}
+}
+
+// WriteAt writes the segment with the sequence number seq. The segments
+// following a missing one are kept in memory until it is written, after which
+// they are all written to the pipeline in sequence by the call writing the
+// missing segment. It is safe to call WriteAt concurrently.
+func (w *OrderedWriter) WriteAt(seq int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if _, ok := w.pending[seq]; ok || seq < w.next {
+		return fmt.Errorf("%w: %d", ErrSequence, seq)
+	}
+	if seq > w.next {
+		w.pending[seq] = append([]byte(nil), data...)
+		return nil
+	}
+
+	for {
+		if _, err := w.p.Write(data); err != nil {
+			w.err = err
+			return err
+		}
+		w.next++
+
+		var ok bool
+		if data, ok = w.pending[w.next]; !ok {
+			return nil
+		}
+		delete(w.pending, w.next)
+	}
+}
+
+// Sum returns the sum of the pipeline, once all the segments have been
+// written. It returns ErrSequenceGap if a segment preceding one that was
+// written is missing.
+func (w *OrderedWriter) Sum() ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	if len(w.pending) > 0 {
+		return nil, fmt.Errorf("%w: segment %d", ErrSequenceGap, w.next)
+	}
+	return w.p.Sum()
+}
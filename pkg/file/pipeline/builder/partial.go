@@ -0,0 +1,75 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"sync/atomic"
+
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/storage"
+)
+
+// ErrNoPartialSum is returned by PartialSum before a data chunk is complete.
+var ErrNoPartialSum = errors.New("pipeline: no complete data chunk")
+
+// PartialSum returns the address of the data written to the pipeline so far,
+// up to the end of the last complete data chunk, for consumers to start
+// reading the data while it is still being written. The data of the trailing,
+// not yet full, data chunk is not covered until the chunk is full. The address
+// is the one of a pipeline written only the data it covers, without the
+// metadata attached WithMetadata, and the intermediate chunks of its trie are
+// stored. The pipeline is not affected, and Sum still returns the address of
+// the whole data. It must not be called concurrently with Write, and is not
+// supported for the pipelines WithRedundancy, which return ErrRedundancy.
+func (p *Pipeline) PartialSum() ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.parities > 0 {
+		return nil, ErrRedundancy
+	}
+	if p.summed {
+		return p.root, p.rootErr
+	}
+	if atomic.LoadInt64(&p.bytes) < p.chunkSize {
+		return nil, ErrNoPartialSum
+	}
+
+	// complete a copy of the trie of the data chunks written so far
+	state, err := p.trie.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	trie := p.newTrie()
+	if err := trie.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	root, err := trie.Sum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.flush(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// newPartialTrieFunc returns a constructor of the hash tries completing the
+// partial sums, the chunks of which are not reported to the chunk recorder and
+// the chunk tap.
+func newPartialTrieFunc(ctx context.Context, s storage.Putter, mode storage.ModePut, encrypt bool, o *options) func() pipeline.ChainWriter {
+	po := *o
+	po.chunkRecorder = nil
+	po.chunkTap = nil
+	return func() pipeline.ChainWriter {
+		if encrypt {
+			return newEncryptionHashTrieWriter(ctx, s, mode, &po)
+		}
+		return newHashTrieWriter(ctx, s, mode, &po)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ErrNotPinnable is returned by the pipelines WithPinOnSuccess when the putter
+// is not a storage.Setter, able to pin chunks.
+var ErrNotPinnable = errors.New("pipeline: not pinnable")
+
+// WithPinOnSuccess makes the pipeline pin all the chunks of the data, and of
+// the metadata attached WithMetadata, once Sum succeeds, with a single Set of
+// storage.ModeSetPin on the putter, which must be a storage.Setter. The chunks
+// are put with the mode of the pipeline until then, so that nothing is pinned
+// if the upload fails or is abandoned. The chunks not put WithDedup because
+// they are already in the store are pinned as well, and every chunk is pinned
+// once, however many times it is repeated in the data. The pipelines with the
+// option are not checkpointable. It has no effect on sharded pipelines.
+func WithPinOnSuccess() Option {
+	return optionFunc(func(o *options) {
+		o.pin = true
+	})
+}
+
+// pinningPutter records the addresses of the chunks put, to pin them once the
+// upload succeeds.
+type pinningPutter struct {
+	storage.Putter
+	setter storage.Setter
+	ctx    context.Context // of the pins
+
+	mu    sync.Mutex
+	seen  swarm.AddressSet
+	addrs []swarm.Address
+}
+
+func (p *pinningPutter) Put(ctx context.Context, mode storage.ModePut, chs ...swarm.Chunk) ([]bool, error) {
+	exist, err := p.Putter.Put(ctx, mode, chs...)
+	if err != nil {
+		return exist, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ch := range chs {
+		if p.seen.Add(ch.Address()) {
+			p.addrs = append(p.addrs, ch.Address())
+		}
+	}
+	return exist, nil
+}
+
+// pin pins the chunks put so far.
+func (p *pinningPutter) pin() error {
+	p.mu.Lock()
+	addrs := p.addrs
+	p.addrs = nil
+	p.mu.Unlock()
+
+	if len(addrs) == 0 {
+		return nil
+	}
+	if err := p.setter.Set(p.ctx, storage.ModeSetPin, addrs...); err != nil {
+		return fmt.Errorf("pin: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethersphere/bee/pkg/encryption"
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+var (
+	// ErrShardIndex is returned by Shard for an index out of range.
+	ErrShardIndex = errors.New("pipeline: invalid shard index")
+	// ErrShardAlignment is returned by Combine when a shard other than the
+	// last one was not written a multiple of the chunk size.
+	ErrShardAlignment = errors.New("pipeline: shard not aligned to chunk size")
+)
+
+// Sharded is a pipeline split into shards, each of which hashes and stores
+// its own range of the data, so that the ranges can be written concurrently.
+type Sharded struct {
+	shards    []*shard
+	trie      pipeline.ChainWriter
+	refSize   int
+	chunkSize int64
+	dedup     *dedupPutter // puts only the chunks not in the store, if enabled
+	err       error        // returned by Shard and Combine when the options are invalid
+}
+
+// NewSharded returns a pipeline with the given number of shards. The shards
+// are written with consecutive ranges of the data and Combine returns the
+// same address as a single pipeline written with the whole data. The options
+// are applied to every shard, except WithAbort, WithLeafIndex,
+// WithChunkRecorder, WithChunkTap, WithLeafStats, WithMetadata,
+// WithPinOnSuccess, WithProgress, WithSize and WithDigest which have no
+// effect.
+func NewSharded(ctx context.Context, s storage.Putter, mode storage.ModePut, encrypt bool, shards int, opts ...Option) *Sharded {
+	o := newOptions(opts)
+	// the offsets of the shards in the data are not known while they are written
+	o.leafIndex = nil
+	o.chunkRecorder = nil
+	o.chunkTap = nil
+	o.leafStats = nil
+
+	p := &Sharded{
+		shards:    make([]*shard, shards),
+		refSize:   swarm.HashSize,
+		chunkSize: int64(o.chunkSize),
+	}
+	if !o.validChunkSize(encrypt) {
+		p.err = ErrChunkSize
+		return p
+	}
+	// the shards do not keep the data chunks the parities are computed from
+	if o.parities != 0 {
+		p.err = ErrRedundancy
+		return p
+	}
+	hasser, _ := s.(storage.Hasser)
+	if o.deadLetter != nil {
+		s = &deadLetterPutter{Putter: s, retries: o.putRetries, sink: o.deadLetter}
+	}
+	if o.dedup && hasser != nil {
+		p.dedup = &dedupPutter{Putter: s, hasser: hasser, batch: o.dedupBatch}
+		s = p.dedup
+	}
+	if encrypt {
+		p.trie = newEncryptionHashTrieWriter(ctx, s, mode, o)
+		p.refSize += encryption.KeyLength
+	} else {
+		p.trie = newHashTrieWriter(ctx, s, mode, o)
+	}
+
+	for i := range p.shards {
+		sh := new(shard)
+		if encrypt {
+			sh.Interface = newEncryptionDataPipeline(ctx, s, mode, o, &sh.refs)
+		} else {
+			sh.Interface = newDataPipeline(ctx, s, mode, o, &sh.refs)
+		}
+		p.shards[i] = sh
+	}
+	return p
+}
+
+// Shard returns the writer of the shard with index i. Writers of different
+// shards may be used concurrently, while each of them must be used by a
+// single goroutine.
+func (p *Sharded) Shard(i int) (io.Writer, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if i < 0 || i >= len(p.shards) {
+		return nil, ErrShardIndex
+	}
+	return p.shards[i], nil
+}
+
+// Combine flushes all the shards and wraps their data chunk references into
+// the trie of the whole data, returning its root address. It must be called
+// once all the writes to the shards have returned. All the shards except the
+// last one must have been written a multiple of the chunk size.
+func (p *Sharded) Combine() (swarm.Address, error) {
+	if p.err != nil {
+		return swarm.ZeroAddress, p.err
+	}
+	for i, sh := range p.shards {
+		if i < len(p.shards)-1 && sh.bytes%p.chunkSize != 0 {
+			return swarm.ZeroAddress, fmt.Errorf("shard %d: %w", i, ErrShardAlignment)
+		}
+		if _, err := sh.Sum(); err != nil {
+			return swarm.ZeroAddress, fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+
+	oneRef := swarm.SpanSize + p.refSize
+	for _, sh := range p.shards {
+		refs := sh.refs
+		for i := 0; i < len(refs); i += oneRef {
+			args := &pipeline.PipeWriteArgs{
+				Span: refs[i : i+swarm.SpanSize],
+				Ref:  refs[i+swarm.SpanSize : i+swarm.SpanSize+swarm.HashSize],
+				Key:  refs[i+swarm.SpanSize+swarm.HashSize : i+oneRef],
+			}
+			if err := p.trie.ChainWrite(args); err != nil {
+				return swarm.ZeroAddress, err
+			}
+		}
+	}
+
+	sum, err := p.trie.Sum()
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	if p.dedup != nil {
+		if err := p.dedup.flush(); err != nil {
+			return swarm.ZeroAddress, err
+		}
+	}
+	return swarm.NewAddress(sum), nil
+}
+
+// shard is the data pipeline of a single shard, collecting the references
+// of the data chunks it produces.
+type shard struct {
+	pipeline.Interface
+	refs  refCollector
+	bytes int64
+}
+
+func (s *shard) Write(b []byte) (int, error) {
+	n, err := s.Interface.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// refCollector concatenates the spans, references and keys written to it.
+type refCollector []byte
+
+func (c *refCollector) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	*c = append(*c, p.Span...)
+	*c = append(*c, p.Ref...)
+	*c = append(*c, p.Key...)
+	return nil
+}
+
+func (c *refCollector) Sum() ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"github.com/ethersphere/bee/pkg/bmtpool"
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// LeafStats are the numbers of distinct and repeated data chunks produced by
+// a pipeline, which quantify the redundancy of its data.
+type LeafStats struct {
+	// Unique is the number of distinct data chunks.
+	Unique int
+	// Duplicates is the number of data chunks that are the same as a
+	// previous one of the data.
+	Duplicates int
+}
+
+// WithLeafStats makes the pipeline keep the addresses of the data chunks it
+// produces, to count the repeated ones, available through LeafStats. The
+// data chunks of encryption pipelines are counted by the addresses of their
+// unencrypted data, as their keys differ unless WithEncryptionSeed is set. It
+// has no effect on sharded pipelines.
+func WithLeafStats() Option {
+	return optionFunc(func(o *options) {
+		o.leafStats = new(leafStatsWriter)
+	})
+}
+
+// LeafStats returns the numbers of distinct and repeated data chunks produced
+// by the pipeline, which are complete once Sum returns. It returns zero stats
+// if the pipeline was not built WithLeafStats.
+func (p *Pipeline) LeafStats() LeafStats {
+	if p.leafStats == nil {
+		return LeafStats{}
+	}
+	return p.leafStats.stats
+}
+
+// withLeafStats prepends the writer counting the data chunks to next, if the
+// leaf stats are enabled.
+func withLeafStats(o *options, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.leafStats == nil {
+		return next
+	}
+	o.leafStats.next = next
+	return o.leafStats
+}
+
+// withPlaintextLeafStats prepends the writer counting the data chunks by the
+// addresses of their unencrypted data to the encryption writer next, if the
+// leaf stats are enabled.
+func withPlaintextLeafStats(o *options, next pipeline.ChainWriter) pipeline.ChainWriter {
+	if o.leafStats == nil {
+		return next
+	}
+	o.leafStats.plaintext = true
+	return withLeafStats(o, next)
+}
+
+type leafStatsWriter struct {
+	next      pipeline.ChainWriter
+	plaintext bool // whether the chunks are hashed, before they are encrypted
+	seen      swarm.AddressSet
+	stats     LeafStats
+}
+
+func (w *leafStatsWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	addr := swarm.NewAddress(p.Ref)
+	if w.plaintext {
+		var err error
+		if addr, err = plaintextAddress(p); err != nil {
+			return err
+		}
+	}
+	if w.seen.Add(addr) {
+		w.stats.Unique++
+	} else {
+		w.stats.Duplicates++
+	}
+	return w.next.ChainWrite(p)
+}
+
+func (w *leafStatsWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
+
+// plaintextAddress returns the address of the unencrypted data chunk.
+func plaintextAddress(p *pipeline.PipeWriteArgs) (swarm.Address, error) {
+	hasher := bmtpool.Get()
+	defer bmtpool.Put(hasher)
+
+	if err := hasher.SetSpanBytes(p.Span); err != nil {
+		return swarm.ZeroAddress, err
+	}
+	if _, err := hasher.Write(p.Data[swarm.SpanSize:]); err != nil {
+		return swarm.ZeroAddress, err
+	}
+	return swarm.NewAddress(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"context"
+	"io"
+
+	"github.com/ethersphere/bee/pkg/file/joiner"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// TransformFunc reads the source data from r and writes the transformed
+// data to w.
+type TransformFunc func(r io.Reader, w io.Writer) error
+
+// Transform streams the data of the source address through the transform
+// function into a new pipeline in a single pass, returning the address of
+// the transformed data.
+func Transform(ctx context.Context, s storage.Storer, src swarm.Address, mode storage.ModePut, encrypt bool, fn TransformFunc) (swarm.Address, error) {
+	j, _, err := joiner.New(ctx, s, src)
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	defer j.Close()
+
+	p := NewPipelineBuilder(ctx, s, mode, encrypt)
+	if err := fn(j, p); err != nil {
+		return swarm.ZeroAddress, err
+	}
+
+	sum, err := p.Sum()
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	return swarm.NewAddress(sum), nil
+}
@@ -6,6 +6,7 @@ package feeder
 
 import (
 	"encoding/binary"
+	"errors"
 
 	"github.com/ethersphere/bee/pkg/file/pipeline"
 	"github.com/ethersphere/bee/pkg/swarm"
@@ -13,6 +14,8 @@ import (
 
 const span = swarm.SpanSize
 
+var errInvalidState = errors.New("invalid chunk feeder state")
+
 type chunkFeeder struct {
 	size      int
 	next      pipeline.ChainWriter
@@ -82,6 +85,10 @@ func (f *chunkFeeder) Write(b []byte) (int, error) {
 		f.bufferIdx = 0
 		w += sp
 		sp = 0
+		// the chunk written may be retained by subsequent writers
+		if len(b)-i >= f.size {
+			d = make([]byte, f.size+span)
+		}
 	}
 	return w, nil
 }
@@ -104,3 +111,19 @@ func (f *chunkFeeder) Sum() ([]byte, error) {
 
 	return f.next.Sum()
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler, returning the data
+// buffered by the feeder that was not yet written to subsequent writers.
+func (f *chunkFeeder) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), f.buffer[:f.bufferIdx]...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing the data
+// buffered by the feeder with the one returned by MarshalBinary.
+func (f *chunkFeeder) UnmarshalBinary(b []byte) error {
+	if len(b) >= f.size {
+		return errInvalidState
+	}
+	f.bufferIdx = copy(f.buffer, b)
+	return nil
+}
@@ -216,6 +216,42 @@ func TestFeederFlush(t *testing.T) {
 	}
 }
 
+// TestFeederRetainedChunks tests that the chunks written by a single write
+// are not overwritten by the next chunks of the write when retained by
+// subsequent writers, as the store writer does.
+func TestFeederRetainedChunks(t *testing.T) {
+	var chunks [][]byte
+	w := &retainingWriter{chunks: &chunks}
+	cf := feeder.NewChunkFeederWriter(4, w)
+
+	if _, err := cf.Write([]byte("abcdefghij")); err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	for i, want := range []string{"abcd", "efgh"} {
+		if got := string(chunks[i][8:]); got != want {
+			t.Fatalf("chunk %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+// retainingWriter keeps the data of the chunks written to it, without
+// copying it.
+type retainingWriter struct {
+	chunks *[][]byte
+}
+
+func (w *retainingWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	*w.chunks = append(*w.chunks, p.Data)
+	return nil
+}
+
+func (w *retainingWriter) Sum() ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
 // countingResultWriter counts how many writes were done to it
 // and passes the results to the caller using the pointer provided
 // in the constructor.
@@ -8,11 +8,16 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/ethersphere/bee/pkg/file"
 	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/file/redundancy"
 	"github.com/ethersphere/bee/pkg/swarm"
 )
 
-var errInconsistentRefs = errors.New("inconsistent reference lengths in level")
+var (
+	errInconsistentRefs = errors.New("inconsistent reference lengths in level")
+	errInvalidState     = errors.New("invalid hash trie state")
+)
 
 type hashTrieWriter struct {
 	branching  int
@@ -22,20 +27,41 @@ type hashTrieWriter struct {
 	cursors    []int  // level cursors, key is level. level 0 is data level
 	buffer     []byte // keeps all level data
 	pipelineFn pipeline.PipelineFunc
+	span       file.SpanCodec
+
+	parities int                   // number of parity chunks of every intermediate chunk
+	parityFn pipeline.PipelineFunc // hashes and stores the parity chunks
+	shards   [][][]byte            // shards of the chunks referenced by the levels, if parities are set
 }
 
-func NewHashTrieWriter(chunkSize, branching, refLen int, pipelineFn pipeline.PipelineFunc) pipeline.ChainWriter {
+// NewHashTrieWriter returns a writer that wraps the references written to it
+// into intermediate chunks, using the span codec to encode their spans.
+func NewHashTrieWriter(chunkSize, branching, refLen int, span file.SpanCodec, pipelineFn pipeline.PipelineFunc) pipeline.ChainWriter {
 	return &hashTrieWriter{
 		cursors:    make([]int, 9),
-		buffer:     make([]byte, swarm.ChunkWithSpanSize*9*2), // double size as temp workaround for weak calculation of needed buffer space
+		buffer:     make([]byte, (chunkSize+swarm.SpanSize)*9*2), // double size as temp workaround for weak calculation of needed buffer space
 		branching:  branching,
 		chunkSize:  chunkSize,
 		refSize:    refLen,
 		fullChunk:  (refLen + swarm.SpanSize) * branching,
 		pipelineFn: pipelineFn,
+		span:       span,
 	}
 }
 
+// NewRedundantHashTrieWriter returns a writer like NewHashTrieWriter, which
+// adds the references of parities parity chunks, produced with parityFn, to
+// every intermediate chunk, after the ones of the branching chunks it wraps.
+// The number of parities is encoded in the spans of the intermediate chunks,
+// which must be serialized by the span codec as little-endian uint64s.
+func NewRedundantHashTrieWriter(chunkSize, branching, refLen, parities int, span file.SpanCodec, pipelineFn, parityFn pipeline.PipelineFunc) pipeline.ChainWriter {
+	h := NewHashTrieWriter(chunkSize, branching, refLen, span, pipelineFn).(*hashTrieWriter)
+	h.parities = parities
+	h.parityFn = parityFn
+	h.shards = make([][][]byte, len(h.cursors))
+	return h
+}
+
 // accepts writes of hashes from the previous writer in the chain, by definition these writes
 // are on level 1
 func (h *hashTrieWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
@@ -44,10 +70,15 @@ func (h *hashTrieWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
 	if l%oneRef != 0 {
 		return errInconsistentRefs
 	}
-	return h.writeToLevel(1, p.Span, p.Ref, p.Key)
+	return h.writeToLevel(1, p.Span, p.Ref, p.Key, p.Data)
 }
 
-func (h *hashTrieWriter) writeToLevel(level int, span, ref, key []byte) error {
+func (h *hashTrieWriter) writeToLevel(level int, span, ref, key, data []byte) error {
+	if h.parities > 0 {
+		shard := make([]byte, swarm.SpanSize+h.chunkSize)
+		copy(shard, data)
+		h.shards[level] = append(h.shards[level], shard)
+	}
 	copy(h.buffer[h.cursors[level]:h.cursors[level]+len(span)], span) //copy the span slongside
 	h.cursors[level] += len(span)
 	copy(h.buffer[h.cursors[level]:h.cursors[level]+len(ref)], ref)
@@ -75,29 +106,11 @@ func (h *hashTrieWriter) writeToLevel(level int, span, ref, key []byte) error {
 
 // assumes that the function has been called when refsize+span*branching has been reached
 func (h *hashTrieWriter) wrapFullLevel(level int) error {
-	data := h.buffer[h.cursors[level+1]:h.cursors[level]]
-	sp := uint64(0)
-	var hashes []byte
-	for i := 0; i < len(data); i += h.refSize + 8 {
-		// sum up the spans of the level, then we need to bmt them and store it as a chunk
-		// then write the chunk address to the next level up
-		sp += binary.LittleEndian.Uint64(data[i : i+8])
-		hash := data[i+8 : i+h.refSize+8]
-		hashes = append(hashes, hash...)
-	}
-	spb := make([]byte, 8)
-	binary.LittleEndian.PutUint64(spb, sp)
-	hashes = append(spb, hashes...)
-	writer := h.pipelineFn()
-	args := pipeline.PipeWriteArgs{
-		Data: hashes,
-		Span: spb,
-	}
-	err := writer.ChainWrite(&args)
+	args, err := h.wrap(level)
 	if err != nil {
 		return err
 	}
-	err = h.writeToLevel(level+1, args.Span, args.Ref, args.Key)
+	err = h.writeToLevel(level+1, args.Span, args.Ref, args.Key, args.Data)
 	if err != nil {
 		return err
 	}
@@ -126,6 +139,10 @@ func (h *hashTrieWriter) hoistLevels(target int) ([]byte, error) {
 			}
 		case l == oneRef:
 			h.cursors[i+1] = h.cursors[i]
+			if h.parities > 0 {
+				h.shards[i+1] = append(h.shards[i+1], h.shards[i]...)
+				h.shards[i] = nil
+			}
 		default:
 			// more than 0 but smaller than chunk size - wrap the level to the one above it
 			err := h.wrapFullLevel(i)
@@ -145,26 +162,67 @@ func (h *hashTrieWriter) hoistLevels(target int) ([]byte, error) {
 	}
 
 	// here we are still with possible length of more than one ref in the highest+1 level
+	args, err := h.wrap(level)
+	if err != nil {
+		return nil, err
+	}
+	return append(args.Ref, args.Key...), nil
+}
+
+// wrap hashes and stores the intermediate chunk of the references of the
+// level, with the references of its parity chunks, if parities are set.
+func (h *hashTrieWriter) wrap(level int) (*pipeline.PipeWriteArgs, error) {
+	data := h.buffer[h.cursors[level+1]:h.cursors[level]]
 	sp := uint64(0)
 	var hashes []byte
 	for i := 0; i < len(data); i += h.refSize + 8 {
 		// sum up the spans of the level, then we need to bmt them and store it as a chunk
 		// then write the chunk address to the next level up
-		sp += binary.LittleEndian.Uint64(data[i : i+8])
+		sp += h.decodeSpan(data[i : i+8])
 		hash := data[i+8 : i+h.refSize+8]
 		hashes = append(hashes, hash...)
 	}
 	spb := make([]byte, 8)
-	binary.LittleEndian.PutUint64(spb, sp)
+	h.span.EncodeSpan(spb, sp)
+
+	if h.parities > 0 {
+		parities, err := redundancy.Encode(h.shards[level], h.parities)
+		if err != nil {
+			return nil, err
+		}
+		h.shards[level] = nil
+		for _, p := range parities {
+			args := pipeline.PipeWriteArgs{
+				Data: p,
+				Span: p[:swarm.SpanSize],
+			}
+			if err := h.parityFn().ChainWrite(&args); err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, args.Ref...)
+		}
+		redundancy.SetParities(spb, h.parities)
+	}
+
 	hashes = append(spb, hashes...)
 	writer := h.pipelineFn()
-	args := pipeline.PipeWriteArgs{
+	args := &pipeline.PipeWriteArgs{
 		Data: hashes,
 		Span: spb,
 	}
-	err := writer.ChainWrite(&args)
-	ref := append(args.Ref, args.Key...)
-	return ref, err
+	if err := writer.ChainWrite(args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// decodeSpan returns the length of the data covered by the chunk with the
+// span, without the number of parities of the chunk, if parities are set.
+func (h *hashTrieWriter) decodeSpan(span []byte) uint64 {
+	if h.parities > 0 {
+		return uint64(redundancy.DecodeSpan(span))
+	}
+	return h.span.DecodeSpan(span)
 }
 
 func (h *hashTrieWriter) levelSize(level int) int {
@@ -187,3 +245,46 @@ func (h *hashTrieWriter) Sum() ([]byte, error) {
 	}
 	return h.hoistLevels(highest)
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler, returning the cursors of
+// the levels followed by the references of the levels not yet wrapped.
+func (h *hashTrieWriter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(h.cursors)*binary.MaxVarintLen64+h.cursors[1])
+	var buf [binary.MaxVarintLen64]byte
+	for _, c := range h.cursors[1:] {
+		b = append(b, buf[:binary.PutUvarint(buf[:], uint64(c))]...)
+	}
+	return append(b, h.buffer[:h.cursors[1]]...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing the levels
+// of the writer with the ones returned by MarshalBinary.
+func (h *hashTrieWriter) UnmarshalBinary(b []byte) error {
+	cursors := make([]int, len(h.cursors))
+	for i := 1; i < len(cursors); i++ {
+		c, n := binary.Uvarint(b)
+		if n <= 0 || c > uint64(len(h.buffer)) {
+			return errInvalidState
+		}
+		cursors[i] = int(c)
+		b = b[n:]
+	}
+	if len(b) != cursors[1] {
+		return errInvalidState
+	}
+
+	oneRef := h.refSize + swarm.SpanSize
+	for i := 1; i < len(cursors); i++ {
+		l := cursors[i]
+		if i < len(cursors)-1 {
+			l -= cursors[i+1]
+		}
+		if l < 0 || l%oneRef != 0 || l >= h.fullChunk {
+			return errInvalidState
+		}
+	}
+
+	copy(h.buffer, b)
+	h.cursors = cursors
+	return nil
+}
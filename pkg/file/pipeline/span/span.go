@@ -0,0 +1,39 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package span
+
+import (
+	"encoding/binary"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+type spanWriter struct {
+	codec file.SpanCodec
+	next  pipeline.ChainWriter
+}
+
+// NewSpanWriter returns a writer that re-encodes the little-endian span
+// prepended to the data with the given codec before passing it on.
+func NewSpanWriter(codec file.SpanCodec, next pipeline.ChainWriter) pipeline.ChainWriter {
+	return &spanWriter{
+		codec: codec,
+		next:  next,
+	}
+}
+
+// ChainWrite assumes that the span field and the first swarm.SpanSize bytes
+// of the data hold the same little-endian span.
+func (w *spanWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	w.codec.EncodeSpan(p.Data[:swarm.SpanSize], binary.LittleEndian.Uint64(p.Data[:swarm.SpanSize]))
+	p.Span = p.Data[:swarm.SpanSize]
+	return w.next.ChainWrite(p)
+}
+
+func (w *spanWriter) Sum() ([]byte, error) {
+	return w.next.Sum()
+}
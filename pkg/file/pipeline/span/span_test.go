@@ -0,0 +1,61 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package span_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file/pipeline"
+	"github.com/ethersphere/bee/pkg/file/pipeline/span"
+)
+
+type flagSpan struct{}
+
+func (flagSpan) EncodeSpan(b []byte, length uint64) {
+	binary.BigEndian.PutUint64(b, length)
+}
+
+func (flagSpan) DecodeSpan(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+type recordingWriter struct {
+	args *pipeline.PipeWriteArgs
+}
+
+func (w *recordingWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
+	w.args = p
+	return nil
+}
+
+func (w *recordingWriter) Sum() ([]byte, error) {
+	return nil, nil
+}
+
+func TestSpanWriter(t *testing.T) {
+	next := &recordingWriter{}
+	w := span.NewSpanWriter(flagSpan{}, next)
+
+	data := make([]byte, 8+3)
+	binary.LittleEndian.PutUint64(data, 3)
+	copy(data[8:], "foo")
+	if err := w.ChainWrite(&pipeline.PipeWriteArgs{Data: data, Span: data[:8]}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, 8)
+	binary.BigEndian.PutUint64(want, 3)
+	if !bytes.Equal(next.args.Span, want) {
+		t.Fatalf("got span %x, want %x", next.args.Span, want)
+	}
+	if !bytes.Equal(next.args.Data[:8], want) {
+		t.Fatalf("got data span %x, want %x", next.args.Data[:8], want)
+	}
+	if !bytes.Equal(next.args.Data[8:], []byte("foo")) {
+		t.Fatal("payload modified")
+	}
+}
@@ -7,6 +7,7 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/ethersphere/bee/pkg/file/pipeline"
 	"github.com/ethersphere/bee/pkg/sctx"
@@ -25,7 +26,7 @@ type storeWriter struct {
 }
 
 // NewStoreWriter returns a storeWriter. It just writes the given data
-// to a given storage.Putter.
+// to a given storage.Putter, until the context is done.
 func NewStoreWriter(ctx context.Context, l storage.Putter, mode storage.ModePut, next pipeline.ChainWriter) pipeline.ChainWriter {
 	return &storeWriter{ctx: ctx, l: l, mode: mode, next: next}
 }
@@ -34,6 +35,9 @@ func (w *storeWriter) ChainWrite(p *pipeline.PipeWriteArgs) error {
 	if p.Ref == nil || p.Data == nil {
 		return errInvalidData
 	}
+	if err := w.ctx.Err(); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
 	tag := sctx.GetTag(w.ctx)
 	var c swarm.Chunk
 	if tag != nil {
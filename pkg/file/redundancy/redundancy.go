@@ -0,0 +1,68 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package redundancy implements the erasure coding of hash tries, which adds
+// parity chunks to every intermediate chunk so that the chunks it references
+// can be reconstructed when some of them are lost.
+//
+// The references of the parity chunks follow the references of the chunks
+// they are computed from in the intermediate chunk, and their number is
+// encoded in the highest byte of its little-endian span, which is zero in the
+// tries without parities. The parity chunks are Reed-Solomon codes of the
+// spans and data of the referenced chunks, padded with zeros to the length of
+// a full chunk, and their addresses are the BMT hashes of the codes, the first
+// swarm.SpanSize bytes of which take the place of the span.
+package redundancy
+
+import (
+	"encoding/binary"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// MaxParities is the maximum number of parity chunks of an intermediate
+// chunk.
+const MaxParities = 64
+
+// spanMask masks out the number of parities from a decoded span.
+const spanMask = 1<<56 - 1
+
+// Parities returns the number of parity references of the intermediate chunk
+// with the span.
+func Parities(span []byte) int {
+	return int(span[swarm.SpanSize-1])
+}
+
+// SetParities encodes the number of parity references in the span.
+func SetParities(span []byte, parities int) {
+	span[swarm.SpanSize-1] = byte(parities)
+}
+
+// DecodeSpan returns the length of the data covered by the chunk with the
+// span, without the number of parities.
+func DecodeSpan(span []byte) int64 {
+	return int64(binary.LittleEndian.Uint64(span) & spanMask)
+}
+
+// ChunkLength returns the length of the span and data of a chunk of a trie
+// with parities, given its span and the maximum length of the data of the
+// chunks, which is the length of the chunk a reconstructed shard is the
+// padding of.
+func ChunkLength(span []byte, chunkSize int) int {
+	length := DecodeSpan(span)
+	parities := Parities(span)
+	if parities == 0 || length <= int64(chunkSize) {
+		return swarm.SpanSize + int(length)
+	}
+
+	// the number of references of an intermediate chunk follows from the
+	// capacity of its subtries
+	branching := int64(chunkSize/swarm.HashSize - parities)
+	size := int64(chunkSize)
+	for size*branching < length {
+		size *= branching
+	}
+	refs := (length + size - 1) / size
+	return swarm.SpanSize + (int(refs)+parities)*swarm.HashSize
+}
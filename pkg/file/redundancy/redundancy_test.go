@@ -0,0 +1,78 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redundancy_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file/redundancy"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// TestReconstruct tests that the data shards are reconstructed from any of
+// the shards as many as them, and that fewer shards are an error.
+func TestReconstruct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, tc := range []struct {
+		data, parities int
+	}{
+		{data: 1, parities: 1},
+		{data: 2, parities: 4},
+		{data: 10, parities: 4},
+		{data: 124, parities: 4},
+		{data: 64, parities: redundancy.MaxParities},
+	} {
+		data := make([][]byte, tc.data)
+		for i := range data {
+			data[i] = make([]byte, 100)
+			_, _ = r.Read(data[i])
+		}
+		parities, err := redundancy.Encode(data, tc.parities)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for lost := 1; lost <= tc.parities+1; lost++ {
+			shards := append(append([][]byte(nil), data...), parities...)
+			for _, i := range r.Perm(len(shards))[:lost] {
+				shards[i] = nil
+			}
+
+			err := redundancy.Reconstruct(shards, tc.data)
+			if lost > tc.parities {
+				if !errors.Is(err, redundancy.ErrTooFewShards) {
+					t.Fatalf("%d+%d shards, %d lost: got error %v, want %v", tc.data, tc.parities, lost, err, redundancy.ErrTooFewShards)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range data {
+				if !bytes.Equal(shards[i], data[i]) {
+					t.Fatalf("%d+%d shards, %d lost: data shard %d not reconstructed", tc.data, tc.parities, lost, i)
+				}
+			}
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	span := make([]byte, swarm.SpanSize)
+	span[0] = 0x10
+	span[1] = 0x20
+	redundancy.SetParities(span, 4)
+
+	if got := redundancy.Parities(span); got != 4 {
+		t.Fatalf("got %d parities, want 4", got)
+	}
+	if got := redundancy.DecodeSpan(span); got != 0x2010 {
+		t.Fatalf("got span %d, want %d", got, 0x2010)
+	}
+}
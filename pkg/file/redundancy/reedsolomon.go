@@ -0,0 +1,182 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redundancy
+
+import "errors"
+
+var (
+	// ErrShardCount is returned by Encode and Reconstruct for no data shards,
+	// or more shards than can be coded.
+	ErrShardCount = errors.New("redundancy: invalid number of shards")
+	// ErrTooFewShards is returned by Reconstruct when fewer shards than the
+	// data shards are present.
+	ErrTooFewShards = errors.New("redundancy: too few shards")
+)
+
+// maxShards is the maximum number of data and parity shards of a code over
+// GF(2^8).
+const maxShards = 256
+
+// the exponentials and logarithms of the elements of GF(2^8), with the
+// generator 2 and the polynomial x^8 + x^4 + x^3 + x^2 + 1
+var (
+	expTable [2 * 255]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func inv(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// mulAdd adds the product of src and c to dst.
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := int(logTable[c])
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= expTable[int(logTable[s])+lc]
+		}
+	}
+}
+
+// coefficient returns the coefficient of the data shard j in the parity shard
+// i of k data shards, from a Cauchy matrix, any square submatrix of which is
+// invertible, so that any k of the shards determine the data shards.
+func coefficient(k, i, j int) byte {
+	return inv(byte(k+i) ^ byte(j))
+}
+
+// Encode returns the parity shards of the data shards, which must all be of
+// the same length.
+func Encode(data [][]byte, parities int) ([][]byte, error) {
+	k := len(data)
+	if k == 0 || parities < 0 || k+parities > maxShards {
+		return nil, ErrShardCount
+	}
+
+	out := make([][]byte, parities)
+	for i := range out {
+		p := make([]byte, len(data[0]))
+		for j, d := range data {
+			mulAdd(p, d, coefficient(k, i, j))
+		}
+		out[i] = p
+	}
+	return out, nil
+}
+
+// Reconstruct fills in the missing data shards, which are nil, from the
+// shards, which are the data shards followed by their parity shards returned
+// by Encode. The missing parity shards are left nil.
+func Reconstruct(shards [][]byte, dataShards int) error {
+	k := dataShards
+	if k == 0 || k > len(shards) || len(shards) > maxShards {
+		return ErrShardCount
+	}
+
+	var missing []int
+	for i := 0; i < k; i++ {
+		if shards[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// the rows of the code of k present shards, preferring the data shards
+	var present []int
+	for i := range shards {
+		if shards[i] != nil {
+			present = append(present, i)
+			if len(present) == k {
+				break
+			}
+		}
+	}
+	if len(present) < k {
+		return ErrTooFewShards
+	}
+	m := make([][]byte, k)
+	for r, s := range present {
+		m[r] = make([]byte, k)
+		if s < k {
+			m[r][s] = 1
+			continue
+		}
+		for j := range m[r] {
+			m[r][j] = coefficient(k, s-k, j)
+		}
+	}
+
+	d := invert(m)
+	for _, i := range missing {
+		shard := make([]byte, len(shards[present[0]]))
+		for r, s := range present {
+			mulAdd(shard, shards[s], d[i][r])
+		}
+		shards[i] = shard
+	}
+	return nil
+}
+
+// invert returns the inverse of the invertible square matrix, which is
+// modified, by Gauss-Jordan elimination.
+func invert(m [][]byte) [][]byte {
+	n := len(m)
+	d := make([][]byte, n)
+	for i := range d {
+		d[i] = make([]byte, n)
+		d[i][i] = 1
+	}
+
+	for c := 0; c < n; c++ {
+		p := c
+		for m[p][c] == 0 {
+			p++
+		}
+		m[c], m[p] = m[p], m[c]
+		d[c], d[p] = d[p], d[c]
+
+		// scale the pivot row to a pivot of one
+		s := inv(m[c][c])
+		for j := 0; j < n; j++ {
+			m[c][j] = mul(m[c][j], s)
+			d[c][j] = mul(d[c][j], s)
+		}
+		// eliminate the column from the other rows
+		for r := 0; r < n; r++ {
+			if r == c || m[r][c] == 0 {
+				continue
+			}
+			f := m[r][c]
+			mulAdd(m[r], m[c], f)
+			mulAdd(d[r], d[c], f)
+		}
+	}
+	return d
+}
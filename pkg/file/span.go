@@ -5,6 +5,7 @@
 package file
 
 import (
+	"encoding/binary"
 	"math"
 
 	"github.com/ethersphere/bee/pkg/swarm"
@@ -42,3 +43,30 @@ func Levels(length int64, sectionSize, branches int) int {
 
 	return int(math.Log(float64(c))/math.Log(float64(b)) + 1)
 }
+
+// SpanCodec converts between the length of data covered by a chunk and the
+// serialized span that is prepended to the chunk payload.
+//
+// Alternative codecs change chunk addresses and are meant for experimenting
+// with different metadata layouts. Content written with a given codec can
+// only be read back by a joiner using the same codec.
+type SpanCodec interface {
+	// EncodeSpan serializes length into b, which is swarm.SpanSize long.
+	EncodeSpan(b []byte, length uint64)
+	// DecodeSpan returns the length serialized in b.
+	DecodeSpan(b []byte) uint64
+}
+
+// LittleEndianSpan is the default span codec, serializing the span as a
+// little-endian uint64.
+var LittleEndianSpan SpanCodec = littleEndianSpan{}
+
+type littleEndianSpan struct{}
+
+func (littleEndianSpan) EncodeSpan(b []byte, length uint64) {
+	binary.LittleEndian.PutUint64(b, length)
+}
+
+func (littleEndianSpan) DecodeSpan(b []byte) uint64 {
+	return binary.LittleEndian.Uint64(b)
+}
@@ -76,6 +76,11 @@ func GetVector(t *testing.T, idx int) ([]byte, swarm.Address) {
 	return data, swarm.MustParseHexAddress(fileExpectHashHex[idx])
 }
 
+// GetVectorLength returns the length of the data of the test vector index.
+func GetVectorLength(idx int) int {
+	return fileLengths[idx]
+}
+
 // GetVectorCount returns the number of available test vectors.
 func GetVectorCount() int {
 	return len(fileLengths)
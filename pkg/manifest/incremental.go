@@ -0,0 +1,57 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/file"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// NewIncrementalManifest creates a new mantaray-based manifest for building
+// manifests too large to be held in memory. It stores itself after every
+// flushEvery entries added to it, which saves the subtrees changed since the
+// previous flush and releases them from memory, to be loaded back only when
+// entries are added to them again. Adding the entries in the order of their
+// paths loads back only the nodes on the path of the last entry. The address
+// returned by Store is the same as the one of a manifest created with
+// NewMantarayManifest with the same entries.
+func NewIncrementalManifest(ls file.LoadSaver, encrypted bool, flushEvery int) (Interface, error) {
+	m, err := NewMantarayManifest(ls, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return &incrementalManifest{Interface: m, flushEvery: flushEvery}, nil
+}
+
+type incrementalManifest struct {
+	Interface
+	flushEvery int
+	pending    int // entries added since the last flush
+}
+
+func (m *incrementalManifest) Add(ctx context.Context, path string, entry Entry) error {
+	if err := m.Interface.Add(ctx, path, entry); err != nil {
+		return err
+	}
+	m.pending++
+	if m.flushEvery > 0 && m.pending >= m.flushEvery {
+		if _, err := m.Store(ctx); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *incrementalManifest) Store(ctx context.Context, storeSizeFn ...StoreSizeFunc) (swarm.Address, error) {
+	addr, err := m.Interface.Store(ctx, storeSizeFn...)
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	m.pending = 0
+	return addr, nil
+}
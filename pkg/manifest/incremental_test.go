@@ -0,0 +1,84 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package manifest_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/file/loadsave"
+	"github.com/ethersphere/bee/pkg/manifest"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/storage/mock"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// TestIncrementalManifest tests that a manifest flushed while entries are
+// added to it has the same address as one built in memory.
+func TestIncrementalManifest(t *testing.T) {
+	ctx := context.Background()
+	ls := loadsave.New(mock.NewStorer(), storage.ModePutUpload, false)
+
+	const entries = 2000
+	entry := func(i int) (string, manifest.Entry) {
+		ref := make([]byte, swarm.HashSize)
+		binary.BigEndian.PutUint64(ref, uint64(i+1))
+		return fmt.Sprintf("dir%d/file%04d.txt", i%7, i), manifest.NewEntry(swarm.NewAddress(ref), map[string]string{"n": fmt.Sprint(i)})
+	}
+
+	m, err := manifest.NewMantarayManifest(ls, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < entries; i++ {
+		path, e := entry(i)
+		if err := m.Add(ctx, path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := m.Store(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flushEvery := range []int{1, 10, 333} {
+		t.Run(fmt.Sprintf("flush every %d", flushEvery), func(t *testing.T) {
+			m, err := manifest.NewIncrementalManifest(ls, false, flushEvery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < entries; i++ {
+				path, e := entry(i)
+				if err := m.Add(ctx, path, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := m.Store(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Fatalf("got address %s, want %s", got, want)
+			}
+
+			m, err = manifest.NewMantarayManifestReference(got, ls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range []int{0, 1, entries / 2, entries - 1} {
+				path, e := entry(i)
+				le, err := m.Lookup(ctx, path)
+				if err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+				if !le.Reference().Equal(e.Reference()) {
+					t.Fatalf("%s: got reference %s, want %s", path, le.Reference(), e.Reference())
+				}
+			}
+		})
+	}
+}
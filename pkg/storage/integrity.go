@@ -0,0 +1,57 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/content"
+	"github.com/ethersphere/bee/pkg/soc"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+type integrityGetStorer struct {
+	Storer
+}
+
+// NewIntegrityGetStorer returns a Storer that checks that every chunk
+// retrieved from the wrapped Storer is a valid content addressed or single
+// owner chunk with the requested address, returning ErrInvalidChunk
+// otherwise.
+func NewIntegrityGetStorer(s Storer) Storer {
+	return &integrityGetStorer{Storer: s}
+}
+
+func (s *integrityGetStorer) Get(ctx context.Context, mode ModeGet, addr swarm.Address) (swarm.Chunk, error) {
+	ch, err := s.Storer.Get(ctx, mode, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIntegrity(addr, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (s *integrityGetStorer) GetMulti(ctx context.Context, mode ModeGet, addrs ...swarm.Address) ([]swarm.Chunk, error) {
+	chs, err := s.Storer.GetMulti(ctx, mode, addrs...)
+	if err != nil {
+		return nil, err
+	}
+	for i, ch := range chs {
+		if err := checkIntegrity(addrs[i], ch); err != nil {
+			return nil, err
+		}
+	}
+	return chs, nil
+}
+
+func checkIntegrity(addr swarm.Address, ch swarm.Chunk) error {
+	if !ch.Address().Equal(addr) || !(content.Valid(ch) || soc.Valid(ch)) {
+		return fmt.Errorf("%w: %s", ErrInvalidChunk, addr)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/storage/mock"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestIntegrityGetStorer(t *testing.T) {
+	ctx := context.Background()
+	inner := mock.NewStorer()
+	s := storage.NewIntegrityGetStorer(inner)
+
+	valid, err := cac.New([]byte("valid data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt, err := cac.New([]byte("corrupt data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptData := append([]byte(nil), corrupt.Data()...)
+	corruptData[len(corruptData)-1] ^= 0xff
+
+	if _, err := inner.Put(ctx, storage.ModePutUpload, valid, swarm.NewChunk(corrupt.Address(), corruptData)); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := s.Get(ctx, storage.ModeGetRequest, valid.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ch.Data(), valid.Data()) {
+		t.Fatal("data mismatch")
+	}
+
+	if _, err := s.Get(ctx, storage.ModeGetRequest, corrupt.Address()); !errors.Is(err, storage.ErrInvalidChunk) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrInvalidChunk)
+	}
+	if _, err := s.Get(ctx, storage.ModeGetRequest, swarm.MustParseHexAddress("aabbcc")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+}
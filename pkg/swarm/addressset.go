@@ -0,0 +1,98 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// ErrInvalidAddressSet is returned when unmarshaling malformed address set data.
+var ErrInvalidAddressSet = errors.New("invalid address set")
+
+// AddressSet is a set of addresses. The zero value is an empty set ready to use.
+// It is not safe for concurrent use.
+type AddressSet struct {
+	m map[string]struct{}
+}
+
+// NewAddressSet returns a set containing the addresses.
+func NewAddressSet(addrs ...Address) *AddressSet {
+	s := &AddressSet{m: make(map[string]struct{}, len(addrs))}
+	for _, a := range addrs {
+		s.Add(a)
+	}
+	return s
+}
+
+// Add adds the address to the set, returning false if it was already in it.
+func (s *AddressSet) Add(a Address) bool {
+	if s.m == nil {
+		s.m = make(map[string]struct{})
+	}
+	k := a.ByteString()
+	if _, ok := s.m[k]; ok {
+		return false
+	}
+	s.m[k] = struct{}{}
+	return true
+}
+
+// Has returns true if the address is in the set.
+func (s *AddressSet) Has(a Address) bool {
+	_, ok := s.m[a.ByteString()]
+	return ok
+}
+
+// Len returns the number of addresses in the set.
+func (s *AddressSet) Len() int {
+	return len(s.m)
+}
+
+// Slice returns the addresses of the set sorted by their bytes.
+func (s *AddressSet) Slice() []Address {
+	addrs := make([]Address, 0, len(s.m))
+	for k := range s.m {
+		addrs = append(addrs, NewAddress([]byte(k)))
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].b, addrs[j].b) < 0
+	})
+	return addrs
+}
+
+// MarshalBinary encodes the sorted addresses of the set, each of them
+// prefixed with its length as an unsigned varint.
+func (s *AddressSet) MarshalBinary() ([]byte, error) {
+	var (
+		buf []byte
+		l   = make([]byte, binary.MaxVarintLen64)
+	)
+	for _, a := range s.Slice() {
+		n := binary.PutUvarint(l, uint64(len(a.b)))
+		buf = append(buf, l[:n]...)
+		buf = append(buf, a.b...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the addresses of the set with the ones encoded
+// by MarshalBinary.
+func (s *AddressSet) UnmarshalBinary(data []byte) error {
+	m := make(map[string]struct{})
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || l > uint64(len(data)-n) {
+			return ErrInvalidAddressSet
+		}
+		data = data[n:]
+		m[string(data[:l])] = struct{}{}
+		data = data[l:]
+	}
+	s.m = m
+	return nil
+}
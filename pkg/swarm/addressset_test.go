@@ -0,0 +1,72 @@
+// Copyright 2020 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestAddressSet(t *testing.T) {
+	a := swarm.MustParseHexAddress("ca1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+	b := swarm.MustParseHexAddress("0a1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+	c := swarm.MustParseHexAddress("4a1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c0a1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+
+	var s swarm.AddressSet
+	if s.Has(a) {
+		t.Fatal("empty set has address")
+	}
+	for _, addr := range []swarm.Address{a, b, c} {
+		if !s.Add(addr) {
+			t.Fatalf("address %s not added", addr)
+		}
+	}
+	if s.Add(swarm.NewAddress(append([]byte(nil), a.Bytes()...))) {
+		t.Fatal("duplicate address added")
+	}
+	if l := s.Len(); l != 3 {
+		t.Fatalf("got length %d, want 3", l)
+	}
+	if !s.Has(b) {
+		t.Fatalf("address %s not in set", b)
+	}
+	if s.Has(swarm.MustParseHexAddress("ff")) {
+		t.Fatal("set has address not added")
+	}
+
+	want := []swarm.Address{b, c, a}
+	got := s.Slice()
+	if len(got) != len(want) {
+		t.Fatalf("got %d addresses, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("address %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := swarm.NewAddressSet(swarm.MustParseHexAddress("ff"))
+	if err := u.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if u.Len() != s.Len() {
+		t.Fatalf("got length %d, want %d", u.Len(), s.Len())
+	}
+	for _, addr := range want {
+		if !u.Has(addr) {
+			t.Fatalf("address %s not in unmarshaled set", addr)
+		}
+	}
+
+	if err := u.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, swarm.ErrInvalidAddressSet) {
+		t.Fatalf("got error %v, want %v", err, swarm.ErrInvalidAddressSet)
+	}
+}
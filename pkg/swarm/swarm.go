@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/sha3"
 )
@@ -33,7 +34,8 @@ var (
 )
 
 var (
-	ErrInvalidChunk = errors.New("invalid chunk")
+	ErrInvalidChunk  = errors.New("invalid chunk")
+	ErrInvalidBzzURL = errors.New("invalid bzz url")
 )
 
 // Address represents an address in Swarm metric space of
@@ -66,6 +68,46 @@ func MustParseHexAddress(s string) Address {
 	return a
 }
 
+// bzzScheme is the URL scheme of Swarm references.
+const bzzScheme = "bzz://"
+
+// ParseBzzURL returns an Address from its bzz:// URL form. A bare
+// hex-encoded reference is accepted as well, while any other scheme or an
+// invalid reference results in ErrInvalidBzzURL. A path following the
+// reference, as in bzz://<reference>/path/file, is ignored; it is returned
+// by ParseBzzURLPath.
+func ParseBzzURL(s string) (a Address, err error) {
+	a, _, err = ParseBzzURLPath(s)
+	return a, err
+}
+
+// ParseBzzURLPath returns an Address and the path following it from the
+// bzz:// URL form, like ParseBzzURL. The path is returned without its leading
+// slash, and is empty if the URL has no path.
+func ParseBzzURLPath(s string) (a Address, path string, err error) {
+	if i := strings.Index(s, "://"); i >= 0 {
+		if !strings.EqualFold(s[:i+3], bzzScheme) {
+			return a, "", fmt.Errorf("%w: unsupported scheme %q", ErrInvalidBzzURL, s[:i])
+		}
+		s = s[i+3:]
+	}
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s, path = s[:i], s[i+1:]
+	}
+	if s == "" {
+		return a, "", fmt.Errorf("%w: missing reference", ErrInvalidBzzURL)
+	}
+	if a, err = ParseHexAddress(s); err != nil {
+		return a, "", fmt.Errorf("%w: %v", ErrInvalidBzzURL, err)
+	}
+	return a, path, nil
+}
+
+// BzzURL returns the bzz:// URL form of the Address.
+func (a Address) BzzURL() string {
+	return bzzScheme + a.String()
+}
+
 // String returns a hex-encoded representation of the Address.
 func (a Address) String() string {
 	return hex.EncodeToString(a.b)
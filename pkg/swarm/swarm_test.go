@@ -81,3 +81,94 @@ func TestAddress_jsonMarshalling(t *testing.T) {
 		t.Error("unmarshalled address is not equal to the original")
 	}
 }
+
+func TestParseBzzURL(t *testing.T) {
+	const ref = "35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b2"
+	want := swarm.MustParseHexAddress(ref)
+
+	for _, tc := range []struct {
+		name     string
+		url      string
+		wantPath string
+		wantErr  error
+	}{
+		{
+			name: "scheme",
+			url:  "bzz://" + ref,
+		},
+		{
+			name: "scheme trailing slash",
+			url:  "bzz://" + ref + "/",
+		},
+		{
+			name:     "path",
+			url:      "bzz://" + ref + "/path/file",
+			wantPath: "path/file",
+		},
+		{
+			name: "bare hex",
+			url:  ref,
+		},
+		{
+			name:     "bare hex path",
+			url:      ref + "/file",
+			wantPath: "file",
+		},
+		{
+			name:    "invalid scheme",
+			url:     "http://" + ref,
+			wantErr: swarm.ErrInvalidBzzURL,
+		},
+		{
+			name:    "missing reference",
+			url:     "bzz://",
+			wantErr: swarm.ErrInvalidBzzURL,
+		},
+		{
+			name:    "invalid hex",
+			url:     "bzz://0",
+			wantErr: swarm.ErrInvalidBzzURL,
+		},
+		{
+			name:    "invalid hex character",
+			url:     "bzz://zz",
+			wantErr: swarm.ErrInvalidBzzURL,
+		},
+		{
+			name:    "missing reference with path",
+			url:     "bzz:///file",
+			wantErr: swarm.ErrInvalidBzzURL,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := swarm.ParseBzzURL(tc.url)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if !a.Equal(want) {
+				t.Errorf("got address %v, want %v", a, want)
+			}
+			a, path, err := swarm.ParseBzzURLPath(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !a.Equal(want) || path != tc.wantPath {
+				t.Errorf("got address %v and path %q, want %v and %q", a, path, want, tc.wantPath)
+			}
+		})
+	}
+
+	if got := want.BzzURL(); got != "bzz://"+ref {
+		t.Fatalf("got url %q, want %q", got, "bzz://"+ref)
+	}
+	a, err := swarm.ParseBzzURL(want.BzzURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Equal(want) {
+		t.Fatalf("got address %v, want %v", a, want)
+	}
+}